@@ -1,192 +1,549 @@
 package api
 
-/*// REST API handlers
-// CRUD Operations Controllers - Food
-func getAllFoods(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	stmt, err := db.Prepare("Select * from food;")
-	if err != nil {
-		log.Fatalln(err)
+/* Package api serves the catalog as JSON under /api/v1 for programmatic
+   clients such as the Android app. Every response body is either the
+   requested data, using the JSON tags of data.Food and data.Ingredient, or
+   an object of the form {"errors": ["..."]}.
+
+	GET    /api/v1/foods                 list foods
+	POST   /api/v1/foods                 create a food (contributor)
+	GET    /api/v1/foods/{barcode}       read a food
+	PUT    /api/v1/foods/{barcode}       replace a food's name and ingredients (contributor)
+	DELETE /api/v1/foods/{barcode}       delete a food (admin)
+	GET    /api/v1/ingredients           list ingredients
+	POST   /api/v1/ingredients           create an ingredient (grader)
+	GET    /api/v1/ingredients/{name}    read an ingredient; an alias is read as the ingredient
+	                                     it stands for, named in "canonical"
+	GET    /api/v1/ingredients/{name}/suggestions
+	                                     list graded ingredients an unknown name may mean,
+	                                     best first, each with a score from 0 to 1
+	PUT    /api/v1/ingredients/{name}    rename or regrade an ingredient (grader)
+	DELETE /api/v1/ingredients/{name}    delete an ingredient (admin); answers 409 while foods
+	                                     still use it unless ?confirm=true is given
+	GET    /api/v1/aliases               list ingredient aliases
+	POST   /api/v1/aliases               make an alias, {"alias": "...", "ingredient": "..."} (admin)
+	DELETE /api/v1/aliases/{alias}       delete an alias (admin)
+	GET    /api/v1/missing               list ingredients waiting for a grade (grader)
+	GET    /api/v1/triage                list them with how often each was seen and the
+	                                     foods each blocks, most seen first (grader)
+	POST   /api/v1/triage/{name}/grade   grade a missing ingredient, {"grade": n} (grader)
+	POST   /api/v1/triage/{name}/alias   make a missing ingredient an alias of a graded one,
+	                                     {"ingredient": "..."} (grader)
+	DELETE /api/v1/triage/{name}         dismiss a missing ingredient (grader)
+	POST   /api/v1/users                 register a viewer account
+	POST   /api/v1/password/forgot       mail a password reset link
+	POST   /api/v1/password/reset        set a new password with a reset token
+	GET    /api/v1/account               read the signed-in account (viewer)
+	PUT    /api/v1/account               change the signed-in account's email (viewer)
+	PUT    /api/v1/account/password      change the signed-in account's password (viewer)
+	GET    /api/v1/account/tokens        list the signed-in account's API tokens (viewer)
+	POST   /api/v1/account/tokens        make an API token, returned only this once (viewer)
+	DELETE /api/v1/account/tokens/{id}   revoke an API token (viewer)
+	GET    /api/v1/users                 list accounts (admin)
+	GET    /api/v1/users/{username}      read an account (admin)
+	PUT    /api/v1/users/{username}      change an account's role or disabled flag (admin)
+	GET    /api/v1/audit                 read the audit log, newest first, filtered by the
+	                                     entity, id, actor, before and limit parameters (admin)
+	GET    /api/v1/lockouts              list lockouts and recent lockout events (admin)
+	DELETE /api/v1/lockouts/{subject}    lift the lockout of user:name or ip:address (admin)
+
+   A food's label is parsed into ingredients with their sub-ingredients
+   unless the body lists the ingredients itself. Compound ingredients
+   without a grade of their own are read with the grade worked out from
+   their sub-ingredients and "derived": true.
+
+   Scripts authenticate by sending an API token, made at /account/tokens,
+   in an Authorization: Bearer header. A token acts with the lower of its
+   scope and its account's role. Browsers use the session cookie instead.
+   Requests without a signed-in user get 401, and users whose role is too
+   low get 403. Requests that change something and send the session cookie
+   must also send the CSRF token, which every GET response carries, in an
+   X-CSRF-Token header. Each client, by token, user or address, has a rate
+   limit described by the X-RateLimit-* headers of every response; past it
+   requests get 429 with a Retry-After header.
+*/
+
+import (
+	"IngredientGrader/auth"
+	"IngredientGrader/data"
+	"IngredientGrader/grading"
+	"IngredientGrader/jobs"
+	"IngredientGrader/server"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// API holds the dependencies shared by the JSON handlers
+type API struct {
+	store    server.Store
+	strategy grading.Strategy
+	queue    *jobs.Queue
+	sessions *auth.Manager
+	resets   *server.PasswordResets
+	guard    *auth.Guard
+	tokens   *auth.Tokens
+}
+
+// New returns an API that reads and writes the catalog through store,
+/* grades foods with strategy and regrades foods on queue when an
+   ingredient changes. Password changes end the user's other sessions
+   through sessions, forgotten passwords are reset through resets, admins
+   lift sign-in lockouts through guard, and users manage their API
+   tokens through tokens
+*/
+func New(store server.Store, strategy grading.Strategy, queue *jobs.Queue, sessions *auth.Manager, resets *server.PasswordResets, guard *auth.Guard, tokens *auth.Tokens) *API {
+	return &API{store: store, strategy: strategy, queue: queue, sessions: sessions, resets: resets, guard: guard, tokens: tokens}
+}
+
+// Mount registers the API's routes on a /api/v1 subrouter of r and
+/* returns the subrouter. Reading foods and ingredients is open to anyone;
+   everything else needs a signed-in user with a high enough role
+*/
+func (a *API) Mount(r *mux.Router) *mux.Router {
+	v1 := r.PathPrefix("/api/v1").Subrouter()
+	v1.HandleFunc("/foods", a.listFoods).Methods("GET")
+	v1.HandleFunc("/foods/{barcode}", a.getFood).Methods("GET")
+	v1.HandleFunc("/ingredients", a.listIngredients).Methods("GET")
+	v1.HandleFunc("/ingredients/{name}", a.getIngredient).Methods("GET")
+	v1.HandleFunc("/ingredients/{name}/suggestions", a.suggestIngredients).Methods("GET")
+	v1.HandleFunc("/aliases", a.listAliases).Methods("GET")
+	v1.HandleFunc("/users", a.register).Methods("POST")
+	v1.HandleFunc("/password/forgot", a.forgotPassword).Methods("POST")
+	v1.HandleFunc("/password/reset", a.resetPassword).Methods("POST")
+
+	viewer := withRole(v1, auth.Viewer)
+	viewer.HandleFunc("/account", a.getAccount).Methods("GET")
+	viewer.HandleFunc("/account", a.updateAccount).Methods("PUT")
+	viewer.HandleFunc("/account/password", a.changePassword).Methods("PUT")
+	viewer.HandleFunc("/account/tokens", a.listTokens).Methods("GET")
+	viewer.HandleFunc("/account/tokens", a.createToken).Methods("POST")
+	viewer.HandleFunc("/account/tokens/{id}", a.revokeToken).Methods("DELETE")
+
+	contributor := withRole(v1, auth.Contributor)
+	contributor.HandleFunc("/foods", a.createFood).Methods("POST")
+	contributor.HandleFunc("/foods/{barcode}", a.updateFood).Methods("PUT")
+
+	grader := withRole(v1, auth.Grader)
+	grader.HandleFunc("/ingredients", a.createIngredient).Methods("POST")
+	grader.HandleFunc("/ingredients/{name}", a.updateIngredient).Methods("PUT")
+	grader.HandleFunc("/missing", a.listMissing).Methods("GET")
+	grader.HandleFunc("/triage", a.listTriage).Methods("GET")
+	grader.HandleFunc("/triage/{name}/grade", a.gradeMissing).Methods("POST")
+	grader.HandleFunc("/triage/{name}/alias", a.aliasMissing).Methods("POST")
+	grader.HandleFunc("/triage/{name}", a.dismissMissing).Methods("DELETE")
+
+	admin := withRole(v1, auth.Admin)
+	admin.HandleFunc("/foods/{barcode}", a.deleteFood).Methods("DELETE")
+	admin.HandleFunc("/ingredients/{name}", a.deleteIngredient).Methods("DELETE")
+	admin.HandleFunc("/aliases", a.createAlias).Methods("POST")
+	admin.HandleFunc("/aliases/{alias}", a.deleteAlias).Methods("DELETE")
+	admin.HandleFunc("/users", a.listUsers).Methods("GET")
+	admin.HandleFunc("/users/{username}", a.getUser).Methods("GET")
+	admin.HandleFunc("/users/{username}", a.updateUser).Methods("PUT")
+	admin.HandleFunc("/audit", a.listAudit).Methods("GET")
+	admin.HandleFunc("/lockouts", a.listLockouts).Methods("GET")
+	admin.HandleFunc("/lockouts/{subject}", a.unlock).Methods("DELETE")
+
+	v1.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteErrors(w, http.StatusNotFound, "no such endpoint")
+	})
+	return v1
+}
+
+// withRole returns a group of routes on r that only users with at least
+// role can reach
+func withRole(r *mux.Router, role auth.Role) *mux.Router {
+	sub := r.NewRoute().Subrouter()
+	sub.Use(auth.RequireRole(role, Deny))
+	return sub
+}
+
+// Deny answers an API request that failed a role check with a JSON error
+func Deny(w http.ResponseWriter, r *http.Request, status int) {
+	if status == http.StatusUnauthorized {
+		WriteErrors(w, status, "you must be signed in")
+		return
 	}
-	sel, err := stmt.Query()
-	if err != nil {
-		log.Fatalln(err)
+	if u, _ := auth.CurrentUser(r); u.Restricted {
+		WriteErrors(w, status, "your role needs two-factor sign-in, which this account has not turned on")
+		return
 	}
-	for sel.Next() {
-		var (
-			bar      string
-			name     string
-			ins      string
-			grade    string
-			numgrade float64
-		)
-		sel.Scan(&bar, &name, &ins, &grade, &numgrade)
-		var f = Food{bar, name, ins, grade, numgrade}
-		json.NewEncoder(w).Encode(f)
+	WriteErrors(w, status, "your role does not allow this")
+}
+
+// DenyCSRF answers an API request whose CSRF token was missing or wrong
+func DenyCSRF(w http.ResponseWriter, r *http.Request) {
+	WriteErrors(w, http.StatusForbidden, "missing or invalid X-CSRF-Token header")
+}
+
+// TooManyRequests answers an API request from a client that has used up
+// its rate limit
+func TooManyRequests(w http.ResponseWriter, r *http.Request, retry time.Duration) {
+	if retry < time.Second {
+		retry = time.Second
 	}
+	WriteErrors(w, http.StatusTooManyRequests, fmt.Sprintf("too many requests, try again in %s", retry.Round(time.Second)))
 }
 
-// Create - Current implentation allows for a single creation per call
-func createFood(w http.ResponseWriter, r *http.Request) {
+// WriteJSON encodes v as the response body with the given status
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	var newFood Food
-	json.NewDecoder(r.Body).Decode(&newFood)
-	log.Println(newFood)
-	// Set up DB query
-	stmt, err := db.Prepare("insert into food values(?, ?, ?, ?, ?)")
-	if err != nil {
-		log.Fatalln(err)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("api.WriteJSON: ", err)
 	}
-	// Fire query string
-	_, err = stmt.Query(newFood.Barcode, newFood.Name, newFood.Ingredients, newFood.Grade, newFood.NumGrade)
-	if err != nil {
-		log.Fatalln(err)
+}
+
+// WriteErrors responds with status and an {"errors": [...]} body
+func WriteErrors(w http.ResponseWriter, status int, errs ...string) {
+	WriteJSON(w, status, map[string][]string{"errors": errs})
+}
+
+// writeStoreError maps an error from the Store onto a status code
+func writeStoreError(w http.ResponseWriter, err error, what string) {
+	switch err {
+	case server.ErrNotFound:
+		WriteErrors(w, http.StatusNotFound, fmt.Sprintf("%s does not exist", what))
+	case server.ErrDuplicate:
+		WriteErrors(w, http.StatusConflict, fmt.Sprintf("%s already exists", what))
+	default:
+		log.Println("api: ", err)
+		WriteErrors(w, http.StatusInternalServerError, "internal error")
 	}
 }
 
-// Read
-func getFood(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	stmt, err := db.Prepare("Select * from food where barcode=?;")
-	if err != nil {
-		log.Fatalln(err)
+// decode reads a JSON request body into v, answering 400 if it cannot
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		WriteErrors(w, http.StatusBadRequest, "request body is not valid JSON")
+		return false
 	}
-	vars := mux.Vars(r)
-	sel, err := stmt.Query(vars["bar"])
-	if err != nil {
-		log.Fatalln(err)
+	return true
+}
+
+// as returns the Store for changes made by r, which records them in the
+// audit log under the signed-in user
+func (a *API) as(r *http.Request) server.Store {
+	u, _ := auth.CurrentUser(r)
+	return server.Audited(a.store, u.Username)
+}
+
+// regrade queues a regrade of every food that lists the ingredient name,
+// recording the new grades under the user who made r
+func (a *API) regrade(r *http.Request, name string) {
+	task := server.RegradeContainingTask(a.as(r), a.strategy, name)
+	if _, err := a.queue.Submit("regrade foods containing "+name, task); err != nil {
+		log.Println("api.regrade: ", err)
+	}
+}
+
+// foodInput is the body accepted when creating or replacing a food. The
+/* ingredients can be given either as a list or as an ingredient statement;
+   the list wins if both are present
+*/
+type foodInput struct {
+	Barcode     string            `json:"barcode"`
+	Name        string            `json:"title"`
+	Label       string            `json:"label"`
+	Ingredients []data.Ingredient `json:"ingredients"`
+}
+
+// toFood validates the input and turns it into an ungraded Food
+func (in foodInput) toFood() (data.Food, []string) {
+	var names []string
+	for _, i := range in.Ingredients {
+		if name := strings.ToLower(strings.Trim(i.Name, " ")); name != "" {
+			names = append(names, name)
+		}
+	}
+	label := strings.ToLower(in.Label)
+	if label == "" {
+		label = strings.Join(names, ", ")
+	}
+
+	food := data.Food{Barcode: strings.Trim(in.Barcode, " "), Name: strings.Trim(in.Name, " "), Label: label}
+	if problems := server.CheckFood(food.Barcode, food.Name, label); problems != nil {
+		return food, problems
 	}
-	for sel.Next() {
-		var (
-			bar      string
-			name     string
-			ins      string
-			grade    string
-			numgrade float64
-		)
-		sel.Scan(&bar, &name, &ins, &grade, &numgrade)
-		var f = Food{bar, name, ins, grade, numgrade}
-		json.NewEncoder(w).Encode(f)
+	if names != nil {
+		food.Ingredients = server.NamesToIngredients(names)
+	} else {
+		food.Ingredients = server.ParseIngredients(label)
 	}
+	return food, nil
 }
 
-// Update
-func updateFood(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	stmt, err := db.Prepare("Select * from food where barcode=?;")
+func (a *API) listFoods(w http.ResponseWriter, r *http.Request) {
+	foods, err := a.store.ListFoods()
 	if err != nil {
-		log.Fatalln(err)
+		writeStoreError(w, err, "")
+		return
 	}
-	rem, err := db.Prepare("update food set title=?, ingredients=?, grade=?, numgrade=? where barcode=?;")
-	if err != nil {
-		log.Fatalln(err)
-	}
-	vars := mux.Vars(r)
-	sel, err := stmt.Query(vars["bar"])
-	var (
-		bar      string
-		name     string
-		ins      string
-		grade    string
-		numgrade float64
-	)
-
-	sel.Scan(&bar, &name, &ins, &grade, &numgrade)
-	rem.Query(name, ins, grade, numgrade, bar)
-	var f = Food{bar, name, ins, grade, numgrade}
-	json.NewEncoder(w).Encode(f)
-}
-
-// Delete
-func deleteFood(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	stmt, err := db.Prepare("delete from food where barcode=?")
-	if err != nil {
-		log.Fatalln(err)
+	if foods == nil {
+		foods = []data.Food{}
 	}
-	vars := mux.Vars(r)
-	stmt.Query(vars["bar"])
+	WriteJSON(w, http.StatusOK, foods)
 }
 
-// CRUD Operation Controllers - Ingredients
-
-// Create
-func createIngredient(w http.ResponseWriter, r *http.Request) {
-	// Set headers
-	w.Header().Set("Content-Type", "application/json")
-	// Get ingredient data from http request
-	var newIngred Ingredient
-	json.NewDecoder(r.Body).Decode(&newIngred)
+func (a *API) getFood(w http.ResponseWriter, r *http.Request) {
+	barcode := mux.Vars(r)["barcode"]
+	food, ok := a.store.GetFood(barcode)
+	if !ok {
+		WriteErrors(w, http.StatusNotFound, fmt.Sprintf("There is no food associated with barcode: %s", barcode))
+		return
+	}
+	// Fill in the grades of compound ingredients as the food was graded
+	food.Ingredients = a.strategy.Grade(food.Ingredients).Ingredients
+	WriteJSON(w, http.StatusOK, food)
+}
 
-	// Set up DB Query
-	stmt, err := db.Prepare("insert into ingredients values(?, ?);")
-	if err != nil {
-		log.Fatalln(err)
+func (a *API) createFood(w http.ResponseWriter, r *http.Request) {
+	var in foodInput
+	if !decode(w, r, &in) {
+		return
 	}
-	_, err = stmt.Query(newIngred.Name, newIngred.Grade)
+	food, problems := in.toFood()
+	if problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	food, err := server.AddFood(a.as(r), a.strategy, food)
 	if err != nil {
-		log.Fatalln(err)
+		writeStoreError(w, err, fmt.Sprintf("Food with barcode: %s", food.Barcode))
+		return
 	}
+	w.Header().Set("Location", "/api/v1/foods/"+food.Barcode)
+	WriteJSON(w, http.StatusCreated, food)
 }
 
-// Read
-func getIngredient(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	stmt, err := db.Prepare("select grade from ingredients where title=?;")
-	if err != nil {
-		log.Println(err)
+func (a *API) updateFood(w http.ResponseWriter, r *http.Request) {
+	var in foodInput
+	if !decode(w, r, &in) {
+		return
 	}
-
-	vars := mux.Vars(r)
-	sel, err := stmt.Query(vars["name"])
-	if err != nil {
-		log.Fatalln(err)
+	barcode := mux.Vars(r)["barcode"]
+	if in.Barcode == "" {
+		in.Barcode = barcode
 	}
-	var (
-		grade int
-	)
-	if sel.Next() {
-		sel.Scan(&grade)
-		if err != nil {
-			log.Println(err)
-		}
-		var i = Ingredient{vars["name"], grade}
-		json.NewEncoder(w).Encode(i)
-	} else {
-		var i = Ingredient{vars["name"], -10}
-		json.NewEncoder(w).Encode(i)
+	if in.Barcode != barcode {
+		WriteErrors(w, http.StatusUnprocessableEntity, "The barcode of a food cannot be changed")
+		return
+	}
+	// Check the food exists before anything is matched or saved for it
+	if _, ok := a.store.GetFood(barcode); !ok {
+		WriteErrors(w, http.StatusNotFound, fmt.Sprintf("There is no food associated with barcode: %s", barcode))
+		return
+	}
+	food, problems := in.toFood()
+	if problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
 	}
+	food, err := server.EditFood(a.as(r), a.strategy, food)
+	if err != nil {
+		writeStoreError(w, err, fmt.Sprintf("Food with barcode: %s", barcode))
+		return
+	}
+	WriteJSON(w, http.StatusOK, food)
 }
 
-// Update
-func updateIngredient(w http.ResponseWriter, r *http.Request) {
-
+func (a *API) deleteFood(w http.ResponseWriter, r *http.Request) {
+	barcode := mux.Vars(r)["barcode"]
+	if err := a.as(r).DeleteFood(barcode); err != nil {
+		writeStoreError(w, err, fmt.Sprintf("Food with barcode: %s", barcode))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// Delete
-func deleteIngredient(w http.ResponseWriter, r *http.Request) {
-
-
-
-
-
+// ingredientInput is the body accepted when creating or changing an
+// ingredient. Grade is a pointer so a missing grade can be told apart from 0
+type ingredientInput struct {
+	Name  string `json:"title"`
+	Grade *int   `json:"grade"`
+}
 
+// toIngredient validates the input with the same checks MakeIngredient uses
+func (in ingredientInput) toIngredient() (data.Ingredient, []string) {
+	name := strings.ToLower(strings.Trim(in.Name, " "))
+	grade := ""
+	if in.Grade != nil {
+		grade = strconv.Itoa(*in.Grade)
+	}
+	g, problems := server.CheckIngredient(name, grade)
+	return data.Ingredient{Name: name, Grade: g}, problems
+}
 
+func (a *API) listIngredients(w http.ResponseWriter, r *http.Request) {
+	list, err := a.store.ListIngredients()
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if list == nil {
+		list = []data.Ingredient{}
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
 
+func (a *API) getIngredient(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(mux.Vars(r)["name"])
+	in := a.store.GetIngredient(name)
+	if in.Grade == -10 {
+		WriteErrors(w, http.StatusNotFound, fmt.Sprintf("Ingredient %s does not exist", name))
+		return
+	}
+	WriteJSON(w, http.StatusOK, in)
+}
 
+func (a *API) suggestIngredients(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(mux.Vars(r)["name"])
+	m, err := server.NewMatcher(a.store)
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	WriteJSON(w, http.StatusOK, m.Suggest(name, server.SuggestLimit, server.SuggestMin))
+}
 
+func (a *API) createIngredient(w http.ResponseWriter, r *http.Request) {
+	var body ingredientInput
+	if !decode(w, r, &body) {
+		return
+	}
+	in, problems := body.toIngredient()
+	if problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	if err := a.as(r).CreateIngredient(in.Name, in.Grade); err != nil {
+		writeStoreError(w, err, fmt.Sprintf("Ingredient %s", in.Name))
+		return
+	}
+	a.regrade(r, in.Name)
+	w.Header().Set("Location", "/api/v1/ingredients/"+in.Name)
+	WriteJSON(w, http.StatusCreated, in)
 }
 
+func (a *API) updateIngredient(w http.ResponseWriter, r *http.Request) {
+	var body ingredientInput
+	if !decode(w, r, &body) {
+		return
+	}
+	name := strings.ToLower(mux.Vars(r)["name"])
+	if body.Name == "" {
+		body.Name = name
+	}
+	in, problems := body.toIngredient()
+	if problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	if err := a.as(r).UpdateIngredient(name, in); err != nil {
+		what := fmt.Sprintf("Ingredient %s", name)
+		if err == server.ErrDuplicate {
+			what = fmt.Sprintf("Ingredient %s", in.Name)
+		}
+		writeStoreError(w, err, what)
+		return
+	}
+	a.regrade(r, in.Name)
+	WriteJSON(w, http.StatusOK, in)
+}
 
+func (a *API) deleteIngredient(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(mux.Vars(r)["name"])
+	if r.URL.Query().Get("confirm") != "true" {
+		foods, err := a.store.FoodsContaining(name)
+		if err != nil {
+			writeStoreError(w, err, "")
+			return
+		}
+		if len(foods) > 0 {
+			barcodes := make([]string, len(foods))
+			for i, f := range foods {
+				barcodes[i] = f.Barcode
+			}
+			WriteErrors(w, http.StatusConflict, fmt.Sprintf(
+				"Ingredient %s is used by %d food(s): %s; repeat with ?confirm=true to delete it anyway",
+				name, len(foods), strings.Join(barcodes, ", ")))
+			return
+		}
+	}
+	aliases, err := server.AliasesOf(a.store, name)
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if err := a.as(r).DeleteIngredient(name); err != nil {
+		writeStoreError(w, err, fmt.Sprintf("Ingredient %s", name))
+		return
+	}
+	// Its aliases are deleted with it, so regrade the foods that list them too
+	for _, n := range append([]string{name}, aliases...) {
+		a.regrade(r, n)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
+func (a *API) listAliases(w http.ResponseWriter, r *http.Request) {
+	list, err := a.store.ListAliases()
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if list == nil {
+		list = []data.Alias{}
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
 
+func (a *API) createAlias(w http.ResponseWriter, r *http.Request) {
+	var body data.Alias
+	if !decode(w, r, &body) {
+		return
+	}
+	alias := data.Alias{
+		Name:       strings.ToLower(strings.Trim(body.Name, " ")),
+		Ingredient: strings.ToLower(strings.Trim(body.Ingredient, " ")),
+	}
+	if problems := server.CheckAlias(alias.Name, alias.Ingredient, a.store); problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	if err := a.as(r).CreateAlias(alias.Name, alias.Ingredient); err != nil {
+		writeStoreError(w, err, fmt.Sprintf("Alias %s", alias.Name))
+		return
+	}
+	a.regrade(r, alias.Name)
+	WriteJSON(w, http.StatusCreated, alias)
+}
 
-router.HandleFunc("/api/food/{bar}", getFood).Methods("GET")
-	router.HandleFunc("/api/food/{bar}", updateFood).Methods("POST")
-	router.HandleFunc("/api/food/delete/{bar}", deleteFood).Methods("POST")
-	router.HandleFunc("/api/food", getAllFoods).Methods("GET")
-	router.HandleFunc("/api/food", createFood).Methods("POST")
-	router.HandleFunc("/api/ingredient", createIngredient).Methods("POST")
-	router.HandleFunc("/api/ingredient/{name}", getIngredient).Methods("GET")
+func (a *API) deleteAlias(w http.ResponseWriter, r *http.Request) {
+	alias := strings.ToLower(mux.Vars(r)["alias"])
+	if err := a.as(r).DeleteAlias(alias); err != nil {
+		writeStoreError(w, err, fmt.Sprintf("Alias %s", alias))
+		return
+	}
+	a.regrade(r, alias)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-*/
+func (a *API) listMissing(w http.ResponseWriter, r *http.Request) {
+	names, err := a.store.ListMissingIngredients()
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	WriteJSON(w, http.StatusOK, names)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"IngredientGrader/auth"
+	"IngredientGrader/data"
+	"IngredientGrader/server"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// gradeInput is the body accepted when grading a missing ingredient
+type gradeInput struct {
+	Grade *int `json:"grade"`
+}
+
+func (a *API) listTriage(w http.ResponseWriter, r *http.Request) {
+	list, err := server.Triage(a.store)
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if list == nil {
+		list = []data.MissingIngredient{}
+	}
+	WriteJSON(w, http.StatusOK, list)
+}
+
+func (a *API) gradeMissing(w http.ResponseWriter, r *http.Request) {
+	var body gradeInput
+	if !decode(w, r, &body) {
+		return
+	}
+	name := strings.ToLower(mux.Vars(r)["name"])
+	grade := ""
+	if body.Grade != nil {
+		grade = strconv.Itoa(*body.Grade)
+	}
+	g, problems := server.CheckIngredient(name, grade)
+	if problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	if err := server.GradeMissing(a.as(r), name, g); err != nil {
+		writeStoreError(w, err, "Ingredient "+name)
+		return
+	}
+	a.regrade(r, name)
+	w.Header().Set("Location", "/api/v1/ingredients/"+name)
+	WriteJSON(w, http.StatusCreated, data.Ingredient{Name: name, Grade: g})
+}
+
+func (a *API) aliasMissing(w http.ResponseWriter, r *http.Request) {
+	var body data.Alias
+	if !decode(w, r, &body) {
+		return
+	}
+	name := strings.ToLower(mux.Vars(r)["name"])
+	canonical := strings.ToLower(strings.Trim(body.Ingredient, " "))
+	if problems := server.CheckAlias(name, canonical, a.store); problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	if err := server.AliasMissing(a.as(r), name, canonical); err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	a.regrade(r, name)
+	WriteJSON(w, http.StatusOK, a.store.GetIngredient(name))
+}
+
+func (a *API) dismissMissing(w http.ResponseWriter, r *http.Request) {
+	u, _ := auth.CurrentUser(r)
+	name := strings.ToLower(mux.Vars(r)["name"])
+	if err := server.DismissMissing(a.store, u.Username, name); err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
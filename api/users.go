@@ -0,0 +1,328 @@
+package api
+
+import (
+	"IngredientGrader/auth"
+	"IngredientGrader/data"
+	"IngredientGrader/server"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// registerInput is the body accepted when creating an account
+type registerInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+// accountInput is the body accepted when changing the signed-in account
+type accountInput struct {
+	Email string `json:"email"`
+}
+
+// forgotInput is the body accepted when asking for a reset link
+type forgotInput struct {
+	Username string `json:"username"`
+}
+
+// resetInput is the body accepted when setting a password with a reset token
+type resetInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// passwordInput is the body accepted when changing a password
+type passwordInput struct {
+	Current  string `json:"current"`
+	Password string `json:"password"`
+}
+
+// tokenInput is the body accepted when making an API token
+type tokenInput struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+}
+
+// newToken is the body returned when an API token is made. Token is not
+// stored and cannot be read again
+type newToken struct {
+	data.APIToken
+	Token string `json:"token"`
+}
+
+// userInput is the body accepted when an admin changes an account. Fields
+// left out are not changed
+type userInput struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+func (a *API) register(w http.ResponseWriter, r *http.Request) {
+	var in registerInput
+	if !decode(w, r, &in) {
+		return
+	}
+	username := strings.Trim(in.Username, " ")
+	email := strings.Trim(in.Email, " ")
+	problems := append(server.CheckUsername(username), server.CheckEmail(email)...)
+	problems = append(problems, server.CheckPassword(username, in.Password)...)
+	if problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	user, err := server.Register(server.Audited(a.store, username), username, in.Password, email)
+	if err != nil {
+		writeStoreError(w, err, fmt.Sprintf("Username %s", username))
+		return
+	}
+	w.Header().Set("Location", "/api/v1/users/"+username)
+	WriteJSON(w, http.StatusCreated, user)
+}
+
+func (a *API) getAccount(w http.ResponseWriter, r *http.Request) {
+	u, _ := auth.CurrentUser(r)
+	a.writeUser(w, u.Username)
+}
+
+func (a *API) updateAccount(w http.ResponseWriter, r *http.Request) {
+	var in accountInput
+	if !decode(w, r, &in) {
+		return
+	}
+	u, _ := auth.CurrentUser(r)
+	email := strings.Trim(in.Email, " ")
+	if problems := server.CheckEmail(email); problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	if err := a.as(r).SetEmail(u.Username, email); err != nil {
+		writeStoreError(w, err, fmt.Sprintf("User %s", u.Username))
+		return
+	}
+	a.writeUser(w, u.Username)
+}
+
+func (a *API) changePassword(w http.ResponseWriter, r *http.Request) {
+	var in passwordInput
+	if !decode(w, r, &in) {
+		return
+	}
+	u, _ := auth.CurrentUser(r)
+	if problems := server.CheckPasswordChange(a.store, u.Username, in.Current, in.Password); problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	if err := server.SetPassword(a.as(r), u.Username, in.Password); err != nil {
+		writeStoreError(w, err, fmt.Sprintf("User %s", u.Username))
+		return
+	}
+	// Sign the user out everywhere else, keeping the session this request
+	// came in on, if any
+	if err := a.sessions.EndOthers(r, u.Username); err != nil {
+		log.Println("api.changePassword: ", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forgotPassword mails a reset link. It answers 202 whether or not the
+// account exists, so it cannot be used to find out which usernames do
+func (a *API) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var in forgotInput
+	if !decode(w, r, &in) {
+		return
+	}
+	username := strings.Trim(in.Username, " ")
+	if username == "" {
+		WriteErrors(w, http.StatusUnprocessableEntity, "Username Field cannot be empty")
+		return
+	}
+	if err := a.resets.Send(username); err != nil {
+		log.Println("api.forgotPassword: ", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *API) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var in resetInput
+	if !decode(w, r, &in) {
+		return
+	}
+	problems, err := a.resets.Reset(in.Token, in.Password)
+	if err == auth.ErrInvalidToken {
+		WriteErrors(w, http.StatusUnprocessableEntity, "This reset link is invalid or has expired")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) listUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := a.store.ListUsers()
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if users == nil {
+		users = []data.User{}
+	}
+	WriteJSON(w, http.StatusOK, users)
+}
+
+func (a *API) getUser(w http.ResponseWriter, r *http.Request) {
+	a.writeUser(w, mux.Vars(r)["username"])
+}
+
+// updateUser changes another account's role or disabled flag. Admins
+// cannot change their own account, so they cannot lock themselves out
+func (a *API) updateUser(w http.ResponseWriter, r *http.Request) {
+	var in userInput
+	if !decode(w, r, &in) {
+		return
+	}
+	username := mux.Vars(r)["username"]
+	if u, _ := auth.CurrentUser(r); u.Username == username {
+		WriteErrors(w, http.StatusUnprocessableEntity, "You cannot change your own account")
+		return
+	}
+	if in.Role != nil && !auth.Role(*in.Role).Valid() {
+		WriteErrors(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s is not a role", *in.Role))
+		return
+	}
+
+	what := fmt.Sprintf("User %s", username)
+	if in.Role != nil {
+		if err := a.as(r).SetRole(username, *in.Role); err != nil {
+			writeStoreError(w, err, what)
+			return
+		}
+	}
+	if in.Disabled != nil {
+		if err := a.as(r).SetDisabled(username, *in.Disabled); err != nil {
+			writeStoreError(w, err, what)
+			return
+		}
+	}
+	a.writeUser(w, username)
+}
+
+// writeUser responds with the account called username
+func (a *API) writeUser(w http.ResponseWriter, username string) {
+	user, ok := a.store.GetUser(username)
+	if !ok {
+		WriteErrors(w, http.StatusNotFound, fmt.Sprintf("User %s does not exist", username))
+		return
+	}
+	WriteJSON(w, http.StatusOK, user)
+}
+
+func (a *API) listTokens(w http.ResponseWriter, r *http.Request) {
+	u, _ := auth.CurrentUser(r)
+	tokens, err := a.tokens.List(u.Username)
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if tokens == nil {
+		tokens = []data.APIToken{}
+	}
+	WriteJSON(w, http.StatusOK, tokens)
+}
+
+// createToken makes an API token. Its scope cannot be higher than the
+// role of the request, so a read-only token cannot make an admin token
+func (a *API) createToken(w http.ResponseWriter, r *http.Request) {
+	var in tokenInput
+	if !decode(w, r, &in) {
+		return
+	}
+	u, _ := auth.CurrentUser(r)
+	name := strings.Trim(in.Name, " ")
+	if problems := server.CheckToken(name, in.Scope, u.Role); problems != nil {
+		WriteErrors(w, http.StatusUnprocessableEntity, problems...)
+		return
+	}
+	token, t, err := a.tokens.Issue(u.Username, name, auth.Role(in.Scope))
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	WriteJSON(w, http.StatusCreated, newToken{APIToken: t, Token: token})
+}
+
+func (a *API) revokeToken(w http.ResponseWriter, r *http.Request) {
+	u, _ := auth.CurrentUser(r)
+	id := mux.Vars(r)["id"]
+	err := a.tokens.Revoke(u.Username, id)
+	if err == auth.ErrNoToken {
+		WriteErrors(w, http.StatusNotFound, fmt.Sprintf("Token %s does not exist", id))
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) listAudit(w http.ResponseWriter, r *http.Request) {
+	entries, err := a.store.ListAudit(server.AuditFilterFrom(r.URL.Query()))
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if entries == nil {
+		entries = []data.AuditEntry{}
+	}
+	WriteJSON(w, http.StatusOK, entries)
+}
+
+// lockoutEventLimit is how many audit entries listLockouts returns
+const lockoutEventLimit = 50
+
+// lockoutList is the body returned when listing lockouts
+type lockoutList struct {
+	Locked []data.Lockout      `json:"locked"`
+	Events []data.LockoutEvent `json:"events"`
+}
+
+func (a *API) listLockouts(w http.ResponseWriter, r *http.Request) {
+	locked, err := a.guard.Locked()
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	events, err := a.guard.Events(lockoutEventLimit)
+	if err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	if locked == nil {
+		locked = []data.Lockout{}
+	}
+	if events == nil {
+		events = []data.LockoutEvent{}
+	}
+	WriteJSON(w, http.StatusOK, lockoutList{Locked: locked, Events: events})
+}
+
+// unlock lifts a lockout. Subjects that are not locked out are let through
+// too, so the call can be repeated safely
+func (a *API) unlock(w http.ResponseWriter, r *http.Request) {
+	u, _ := auth.CurrentUser(r)
+	if err := a.guard.Unlock(mux.Vars(r)["subject"], u.Username); err != nil {
+		writeStoreError(w, err, "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,46 @@
+package auth
+
+/* Package auth keeps track of who is signed in. A successful login creates
+   a server-side session whose random ID is handed to the browser in a
+   cookie; Middleware resolves that cookie on every request so handlers can
+   call CurrentUser.
+*/
+
+import (
+	"IngredientGrader/data"
+	"context"
+	"net/http"
+)
+
+// User is the signed-in account attached to a request
+/*	Username - The account's name
+	Role - What the request may do
+	Restricted - The account's role needs two-factor sign-in, which it has
+	not turned on, so Role has been lowered to Viewer until it does
+*/
+type User struct {
+	Username   string
+	Role       Role
+	Restricted bool
+}
+
+// Users looks up accounts. server.Store satisfies it
+type Users interface {
+	GetUser(username string) (data.User, bool)
+}
+
+type contextKey int
+
+const userKey contextKey = 0
+
+// WithUser returns a copy of r that CurrentUser will report as signed in as u
+func WithUser(r *http.Request, u User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey, u))
+}
+
+// CurrentUser returns the user signed in for this request. The second
+// value is false if nobody is signed in
+func CurrentUser(r *http.Request) (User, bool) {
+	u, ok := r.Context().Value(userKey).(User)
+	return u, ok
+}
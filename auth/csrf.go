@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// csrfKey is the request context key the CSRF token is kept under
+const csrfKey contextKey = 1
+
+// CSRF protects form POSTs from being forged by other sites
+/* Every request is given a token that pages print into their forms as a
+   hidden field. The token is an HMAC of the browser's session ID, so it
+   changes whenever the user signs in or out. Visitors with no session get
+   a random cookie to stand in for one, which protects the login and
+   registration forms as well.
+	CookieName - The cookie that stands in for a session
+	FieldName - The form field the token is read from
+	HeaderName - The header the token is read from, for scripts
+	Secure - Whether the cookie is only sent over HTTPS
+	Failed - Answers requests whose token is missing or wrong
+	Exempt - Reports whether a request may skip the check. nil means only
+	bearer token requests may
+*/
+type CSRF struct {
+	sessions   *Manager
+	secret     []byte
+	CookieName string
+	FieldName  string
+	HeaderName string
+	Secure     bool
+	Failed     http.HandlerFunc
+	Exempt     func(r *http.Request) bool
+}
+
+// NewCSRF returns a CSRF that ties tokens to the sessions of sessions and
+// signs them with secret. Failed requests get a plain 403 until Failed is set
+func NewCSRF(sessions *Manager, secret []byte) *CSRF {
+	return &CSRF{
+		sessions:   sessions,
+		secret:     secret,
+		CookieName: "grader_csrf",
+		FieldName:  "csrf_token",
+		HeaderName: "X-CSRF-Token",
+		Secure:     sessions.Secure,
+		Failed: func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "invalid CSRF token", http.StatusForbidden)
+		},
+	}
+}
+
+// CSRFToken returns the token forms on this request's page must include
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey).(string)
+	return token
+}
+
+// sign returns the token for a session ID or stand-in cookie value
+func (c *CSRF) sign(seed string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(seed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// seed returns what the request's token is tied to: its session, pending
+/* or not, if it has one, and otherwise its stand-in cookie, which is set
+   on w if the browser does not have one yet
+*/
+func (c *CSRF) seed(w http.ResponseWriter, r *http.Request) (string, error) {
+	if s, ok := c.sessions.lookup(r); ok {
+		return s.ID, nil
+	}
+	if cookie, err := r.Cookie(c.CookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	value, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.CookieName,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   c.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return value, nil
+}
+
+// safeMethod returns true for methods that must not change anything
+func safeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS" || method == "TRACE"
+}
+
+// Bearer returns true if the request carries an Authorization: Bearer
+/* header. Browsers never add one to a cross-site request on their own, so
+   such requests cannot be forged the way cookie-authenticated ones can
+*/
+func Bearer(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// Middleware gives every request its token and turns away any request
+/* that could change something, such as a POST, unless it carries the
+   token in FieldName or HeaderName. Requests using bearer tokens are let
+   through, since they do not rely on cookies. Responses to GET requests
+   carry the token in HeaderName, so scripts using the session cookie can
+   read it
+*/
+func (c *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seed, err := c.seed(w, r)
+		if err != nil {
+			log.Println("auth.CSRF: ", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		token := c.sign(seed)
+		r = r.WithContext(context.WithValue(r.Context(), csrfKey, token))
+
+		if safeMethod(r.Method) {
+			w.Header().Set(c.HeaderName, token)
+		} else if !Bearer(r) && (c.Exempt == nil || !c.Exempt(r)) {
+			sent := r.Header.Get(c.HeaderName)
+			if sent == "" {
+				sent = r.PostFormValue(c.FieldName)
+			}
+			if !hmac.Equal([]byte(sent), []byte(token)) {
+				c.Failed(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
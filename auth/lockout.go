@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"IngredientGrader/data"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Lockout actions recorded in the audit table
+const (
+	ActionLocked   = "locked"
+	ActionUnlocked = "unlocked"
+)
+
+// TrustProxy makes ClientIP believe the X-Forwarded-For header. Only set it
+// when the server sits behind a proxy that sets the header itself
+var TrustProxy bool
+
+// FailureStore persists failed sign-in counts and the lockout audit table
+type FailureStore interface {
+	// Get returns the record for subject. The second value is false if
+	// nothing has failed for subject
+	Get(subject string) (data.Lockout, bool, error)
+	// Fail counts a failure for subject at t and returns the new record.
+	// Failures counted before since are forgotten first
+	Fail(subject string, t, since time.Time) (data.Lockout, error)
+	// Lock stops subject signing in until until
+	Lock(subject string, until time.Time) error
+	// Clear forgets every failure and lockout of subject
+	Clear(subject string) error
+	// ListLocked returns every subject locked out after t
+	ListLocked(t time.Time) ([]data.Lockout, error)
+	// Record appends an entry to the audit table
+	Record(e data.LockoutEvent) error
+	// ListEvents returns the latest limit entries of the audit table, newest
+	// first
+	ListEvents(limit int) ([]data.LockoutEvent, error)
+}
+
+// Guard slows down and then locks out repeated failed sign-ins
+/* Failures are counted for the username and for the address they came
+   from, so guessing many passwords for one account and one password for
+   many accounts are both caught. After FreeAttempts failures in a row each
+   further attempt must wait twice as long as the last, from BaseDelay up to
+   MaxDelay, and after LockAfter failures (LockAfterIP for addresses) the
+   subject is locked out for LockFor and an entry is written to the audit
+   table. Failures further apart than Window are not counted together. The
+   checks run before any password is compared, so a locked out account costs
+   nothing to refuse.
+*/
+type Guard struct {
+	store        FailureStore
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockAfter    int
+	LockAfterIP  int
+	LockFor      time.Duration
+	Window       time.Duration
+}
+
+// NewGuard returns a Guard that counts failures in store, with three free
+/* attempts, delays from one second to five minutes, a 15 minute lockout
+   after 10 failures for a username or 100 for an address, and an hour's
+   window
+*/
+func NewGuard(store FailureStore) *Guard {
+	return &Guard{
+		store:        store,
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockAfter:    10,
+		LockAfterIP:  100,
+		LockFor:      15 * time.Minute,
+		Window:       time.Hour,
+	}
+}
+
+// UserSubject returns the subject failures for username are counted under
+func UserSubject(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+// IPSubject returns the subject failures from ip are counted under
+func IPSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// ClientIP returns the address a request came from, without its port
+func ClientIP(r *http.Request) string {
+	if TrustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Wait returns how long username must wait before signing in from ip
+/* again, or 0 if they may try now. Store errors are logged and let the
+   attempt through, so a database problem cannot lock everyone out
+*/
+func (g *Guard) Wait(username, ip string) time.Duration {
+	now := time.Now()
+	var wait time.Duration
+	for _, subject := range []string{UserSubject(username), IPSubject(ip)} {
+		l, ok, err := g.store.Get(subject)
+		if err != nil {
+			log.Println("auth.Wait: ", err)
+			continue
+		}
+		if ok {
+			if w := g.wait(l, now); w > wait {
+				wait = w
+			}
+		}
+	}
+	return wait
+}
+
+// wait returns how long after now the next attempt for l is allowed
+func (g *Guard) wait(l data.Lockout, now time.Time) time.Duration {
+	if l.LockedUntil.After(now) {
+		return l.LockedUntil.Sub(now)
+	}
+	if l.Failures < g.FreeAttempts || now.Sub(l.LastFailure) > g.Window {
+		return 0
+	}
+	delay := g.MaxDelay
+	if n := l.Failures - g.FreeAttempts; n < 30 {
+		if d := g.BaseDelay << uint(n); d > 0 && d < g.MaxDelay {
+			delay = d
+		}
+	}
+	if next := l.LastFailure.Add(delay); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// Fail counts a failed sign-in for username from ip, locking either out if
+// it has failed too many times
+func (g *Guard) Fail(username, ip string) {
+	g.fail(UserSubject(username), g.LockAfter)
+	g.fail(IPSubject(ip), g.LockAfterIP)
+}
+
+// fail counts a failure for subject and locks it out once it reaches limit
+func (g *Guard) fail(subject string, limit int) {
+	now := time.Now()
+	l, err := g.store.Fail(subject, now, now.Add(-g.Window))
+	if err != nil {
+		log.Println("auth.Fail: ", err)
+		return
+	}
+	if l.Failures < limit || l.LockedUntil.After(now) {
+		return
+	}
+	if err := g.store.Lock(subject, now.Add(g.LockFor)); err != nil {
+		log.Println("auth.Fail: ", err)
+		return
+	}
+	log.Printf("auth.Fail: %s locked out after %d failed sign-ins", subject, l.Failures)
+	e := data.LockoutEvent{Subject: subject, Action: ActionLocked, Failures: l.Failures, At: now}
+	if err := g.store.Record(e); err != nil {
+		log.Println("auth.Fail: ", err)
+	}
+}
+
+// Succeed forgets the failures of username after they sign in. Those of
+/* their address are kept, so an attacker cannot wipe them by signing in to
+   an account of their own between guesses
+*/
+func (g *Guard) Succeed(username string) {
+	if err := g.store.Clear(UserSubject(username)); err != nil {
+		log.Println("auth.Succeed: ", err)
+	}
+}
+
+// Unlock lifts the lockout of subject on behalf of the admin actor and
+// records it in the audit table
+func (g *Guard) Unlock(subject, actor string) error {
+	l, _, err := g.store.Get(subject)
+	if err != nil {
+		return err
+	}
+	if err := g.store.Clear(subject); err != nil {
+		return err
+	}
+	return g.store.Record(data.LockoutEvent{
+		Subject:  subject,
+		Action:   ActionUnlocked,
+		Actor:    actor,
+		Failures: l.Failures,
+		At:       time.Now(),
+	})
+}
+
+// Locked returns every username and address that is locked out now
+func (g *Guard) Locked() ([]data.Lockout, error) {
+	return g.store.ListLocked(time.Now())
+}
+
+// Events returns the latest limit entries of the audit table
+func (g *Guard) Events(limit int) ([]data.LockoutEvent, error) {
+	return g.store.ListEvents(limit)
+}
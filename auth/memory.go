@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"IngredientGrader/data"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemorySessions is a SessionStore that keeps sessions in memory. Sessions
+// are lost when the server restarts and are not shared between instances
+type MemorySessions struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewMemorySessions returns an empty MemorySessions
+func NewMemorySessions() *MemorySessions {
+	return &MemorySessions{sessions: make(map[string]Session)}
+}
+
+// Create saves a new session
+func (m *MemorySessions) Create(s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.ID] = s
+	return nil
+}
+
+// Get returns the session with a matching ID
+func (m *MemorySessions) Get(id string) (Session, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	return s, ok, nil
+}
+
+// Touch records that a session was used at t
+func (m *MemorySessions) Touch(id string, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[id]; ok {
+		s.LastSeen = t
+		m.sessions[id] = s
+	}
+	return nil
+}
+
+// Delete removes a session
+func (m *MemorySessions) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// DeleteExpired removes every session last seen before idle or created
+// before absolute
+func (m *MemorySessions) DeleteExpired(idle, absolute time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if s.LastSeen.Before(idle) || s.Created.Before(absolute) {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+// DeleteUser removes every session belonging to username
+func (m *MemorySessions) DeleteUser(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if s.Username == username {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+// MemoryResets is a ResetStore that keeps outstanding resets in memory.
+// Reset links stop working when the server restarts
+type MemoryResets struct {
+	mu     sync.Mutex
+	resets map[string]Reset
+}
+
+// NewMemoryResets returns an empty MemoryResets
+func NewMemoryResets() *MemoryResets {
+	return &MemoryResets{resets: make(map[string]Reset)}
+}
+
+// Create saves a new reset
+func (m *MemoryResets) Create(r Reset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resets[r.ID] = r
+	return nil
+}
+
+// Get returns the reset with a matching ID
+func (m *MemoryResets) Get(id string) (Reset, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.resets[id]
+	return r, ok, nil
+}
+
+// Delete removes a reset
+func (m *MemoryResets) Delete(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.resets[id]
+	delete(m.resets, id)
+	return ok, nil
+}
+
+// DeleteUser removes every reset for username
+func (m *MemoryResets) DeleteUser(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, r := range m.resets {
+		if r.Username == username {
+			delete(m.resets, id)
+		}
+	}
+	return nil
+}
+
+// DeleteExpired removes every reset that expired before t
+func (m *MemoryResets) DeleteExpired(t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, r := range m.resets {
+		if r.Expires.Before(t) {
+			delete(m.resets, id)
+		}
+	}
+	return nil
+}
+
+// MemoryFailures is a FailureStore that keeps failed sign-ins in memory.
+/* Counts and lockouts are forgotten when the server restarts and are not
+   shared between instances, so each instance allows its own attempts
+*/
+type MemoryFailures struct {
+	mu       sync.Mutex
+	failures map[string]data.Lockout
+	events   []data.LockoutEvent
+}
+
+// NewMemoryFailures returns an empty MemoryFailures
+func NewMemoryFailures() *MemoryFailures {
+	return &MemoryFailures{failures: make(map[string]data.Lockout)}
+}
+
+// Get returns the record for subject
+func (m *MemoryFailures) Get(subject string) (data.Lockout, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.failures[subject]
+	return l, ok, nil
+}
+
+// Fail counts a failure for subject at t, forgetting those before since
+func (m *MemoryFailures) Fail(subject string, t, since time.Time) (data.Lockout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.failures[subject]
+	l.Subject = subject
+	if l.LastFailure.Before(since) {
+		l.Failures = 0
+	}
+	l.Failures++
+	l.LastFailure = t
+	m.failures[subject] = l
+	return l, nil
+}
+
+// Lock stops subject signing in until until
+func (m *MemoryFailures) Lock(subject string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.failures[subject]; ok {
+		l.LockedUntil = until
+		m.failures[subject] = l
+	}
+	return nil
+}
+
+// Clear forgets every failure and lockout of subject
+func (m *MemoryFailures) Clear(subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.failures, subject)
+	return nil
+}
+
+// ListLocked returns every subject locked out after t, dropping records
+// that are no longer worth keeping
+func (m *MemoryFailures) ListLocked(t time.Time) ([]data.Lockout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var locked []data.Lockout
+	for subject, l := range m.failures {
+		if l.LockedUntil.After(t) {
+			locked = append(locked, l)
+		} else if t.Sub(l.LastFailure) > 24*time.Hour {
+			delete(m.failures, subject)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool { return locked[i].Subject < locked[j].Subject })
+	return locked, nil
+}
+
+// Record appends an entry to the audit table
+func (m *MemoryFailures) Record(e data.LockoutEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, e)
+	return nil
+}
+
+// ListEvents returns the latest limit entries of the audit table
+func (m *MemoryFailures) ListEvents(limit int) ([]data.LockoutEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []data.LockoutEvent
+	for i := len(m.events) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, m.events[i])
+	}
+	return events, nil
+}
+
+// MemoryTokens is a TokenStore that keeps API tokens in memory. Tokens
+// stop working when the server restarts
+type MemoryTokens struct {
+	mu     sync.Mutex
+	tokens map[string]data.APIToken
+}
+
+// NewMemoryTokens returns an empty MemoryTokens
+func NewMemoryTokens() *MemoryTokens {
+	return &MemoryTokens{tokens: make(map[string]data.APIToken)}
+}
+
+// Create saves a new token
+func (m *MemoryTokens) Create(t data.APIToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[t.Hash] = t
+	return nil
+}
+
+// Get returns the token with a matching hash
+func (m *MemoryTokens) Get(hash string) (data.APIToken, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[hash]
+	return t, ok, nil
+}
+
+// List returns every token belonging to username, oldest first
+func (m *MemoryTokens) List(username string) ([]data.APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tokens []data.APIToken
+	for _, t := range m.tokens {
+		if t.Username == username {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+	return tokens, nil
+}
+
+// Delete removes username's token with a matching ID
+func (m *MemoryTokens) Delete(username, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hash, t := range m.tokens {
+		if t.ID == id && t.Username == username {
+			delete(m.tokens, hash)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Touch records that the token with a matching hash was used at t
+func (m *MemoryTokens) Touch(hash string, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if token, ok := m.tokens[hash]; ok {
+		token.LastUsed = t
+		m.tokens[hash] = token
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for a reset token that was forged, has
+// expired or has already been used
+var ErrInvalidToken = errors.New("auth: reset token is invalid or has expired")
+
+// Reset is an outstanding password reset
+/*	ID - The hash of the random part of the token. Like session IDs, the
+	token itself is never stored
+	Username - The account whose password the token resets
+	Expires - When the token stops working
+*/
+type Reset struct {
+	ID       string
+	Username string
+	Expires  time.Time
+}
+
+// ResetStore persists outstanding password resets
+type ResetStore interface {
+	// Create saves a new reset
+	Create(r Reset) error
+	// Get returns the reset with a matching ID. The second value is false
+	// if there is no such reset
+	Get(id string) (Reset, bool, error)
+	// Delete removes a reset. The second value is false if there was no
+	// such reset, which means someone else used it first
+	Delete(id string) (bool, error)
+	// DeleteUser removes every reset for username
+	DeleteUser(username string) error
+	// DeleteExpired removes every reset that expired before t
+	DeleteExpired(t time.Time) error
+}
+
+// Resets issues and redeems password reset tokens
+/* A token is random.expiry.signature, where signature is an HMAC-SHA256 of
+   the rest under the server's secret. The signature lets forged or altered
+   tokens be turned away without touching the database, and the stored hash
+   of the random part makes each token single use.
+	TTL - How long a token works for after it is issued
+*/
+type Resets struct {
+	store  ResetStore
+	secret []byte
+	TTL    time.Duration
+}
+
+// NewResets returns a Resets that keeps outstanding resets in store and
+/* signs tokens with secret. Tokens last an hour
+ */
+func NewResets(store ResetStore, secret []byte) *Resets {
+	return &Resets{store: store, secret: secret, TTL: time.Hour}
+}
+
+// sign returns the signature of the unsigned part of a token
+func (rs *Resets) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, rs.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue returns a new reset token for username
+func (rs *Resets) Issue(username string) (string, error) {
+	now := time.Now()
+	if err := rs.store.DeleteExpired(now); err != nil {
+		log.Println("auth.Issue: ", err)
+	}
+
+	random, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	expires := now.Add(rs.TTL)
+	r := Reset{ID: hashToken(random), Username: username, Expires: expires}
+	if err := rs.store.Create(r); err != nil {
+		return "", err
+	}
+	unsigned := random + "." + strconv.FormatInt(expires.Unix(), 10)
+	return unsigned + "." + rs.sign(unsigned), nil
+}
+
+// Check returns the outstanding reset for token without using it up, so a
+// reset page can tell the user their link is bad before they fill it in
+func (rs *Resets) Check(token string) (Reset, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Reset{}, ErrInvalidToken
+	}
+	unsigned := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(rs.sign(unsigned))) {
+		return Reset{}, ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return Reset{}, ErrInvalidToken
+	}
+
+	r, ok, err := rs.store.Get(hashToken(parts[0]))
+	if err != nil {
+		return Reset{}, err
+	}
+	if !ok || time.Now().After(r.Expires) {
+		return Reset{}, ErrInvalidToken
+	}
+	return r, nil
+}
+
+// Redeem uses up token and returns the username it resets. Every other
+/* outstanding token for the same account is cancelled too
+ */
+func (rs *Resets) Redeem(token string) (string, error) {
+	r, err := rs.Check(token)
+	if err != nil {
+		return "", err
+	}
+	deleted, err := rs.store.Delete(r.ID)
+	if err != nil {
+		return "", err
+	}
+	if !deleted {
+		return "", ErrInvalidToken
+	}
+	if err := rs.store.DeleteUser(r.Username); err != nil {
+		log.Println("auth.Redeem: ", err)
+	}
+	return r.Username, nil
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Role is what a user is allowed to do. Each role can do everything the
+/* roles before it can:
+	Viewer - look up foods
+	Contributor - add foods
+	Grader - add and grade ingredients
+	Admin - manage the catalog and other users
+*/
+type Role string
+
+// The roles a user can have, from least to most trusted
+const (
+	Viewer      Role = "viewer"
+	Contributor Role = "contributor"
+	Grader      Role = "grader"
+	Admin       Role = "admin"
+)
+
+// Roles lists every role from least to most trusted
+var Roles = []Role{Viewer, Contributor, Grader, Admin}
+
+// rank returns the position of r in Roles, or -1 if r is not a role
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Valid returns true if r is one of Roles
+func (r Role) Valid() bool {
+	return r.rank() >= 0
+}
+
+// Allows returns true if a user with role r may do what needs required
+func (r Role) Allows(required Role) bool {
+	return r.rank() >= 0 && r.rank() >= required.rank()
+}
+
+// DenyFunc answers a request that failed a role check. status is
+/* http.StatusUnauthorized if nobody is signed in and http.StatusForbidden
+   if the signed-in user's role is too low
+*/
+type DenyFunc func(w http.ResponseWriter, r *http.Request, status int)
+
+// RequireRole returns middleware that only lets through requests from a
+/* signed-in user whose role allows required. Everything else is handed to
+   deny. Use it on a subrouter holding the routes that need the same role
+*/
+func RequireRole(required Role, deny DenyFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, ok := CurrentUser(r)
+			if !ok {
+				deny(w, r, http.StatusUnauthorized)
+				return
+			}
+			if !u.Role.Allows(required) {
+				deny(w, r, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
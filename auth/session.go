@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"IngredientGrader/data"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Session is a signed-in browser
+/*	ID - The hash of the token held in the browser's cookie. The token itself
+	is never stored, so a leaked sessions table cannot be replayed
+	Username - The user the session belongs to
+	Created - When the user signed in
+	LastSeen - The last time the session was used
+	Pending - The user has given their password but still owes a two-factor
+	code. Pending sessions do not sign anyone in
+*/
+type Session struct {
+	ID       string
+	Username string
+	Created  time.Time
+	LastSeen time.Time
+	Pending  bool
+}
+
+// SessionStore persists sessions between requests
+type SessionStore interface {
+	// Create saves a new session
+	Create(s Session) error
+	// Get returns the session with a matching ID. The second value is
+	// false if there is no such session
+	Get(id string) (Session, bool, error)
+	// Touch records that a session was used at t
+	Touch(id string, t time.Time) error
+	// Delete removes a session
+	Delete(id string) error
+	// DeleteExpired removes every session last seen before idle or
+	// created before absolute
+	DeleteExpired(idle, absolute time.Time) error
+	// DeleteUser removes every session belonging to username
+	DeleteUser(username string) error
+}
+
+// Manager issues, checks and ends sessions
+/*	CookieName - The name of the session cookie
+	IdleTimeout - How long a session lasts without being used
+	MaxAge - How long a session lasts after sign in, however often it is used
+	PendingTimeout - How long a user has to enter their two-factor code
+	Secure - Whether the cookie is only sent over HTTPS. Only turn this off
+	for local development over plain HTTP
+	RequireTwoFactor - Reports whether accounts with a role must use
+	two-factor sign-in. Until they turn it on, such accounts are signed in
+	as Restricted viewers. nil means no role needs it
+*/
+type Manager struct {
+	store            SessionStore
+	users            Users
+	CookieName       string
+	IdleTimeout      time.Duration
+	MaxAge           time.Duration
+	PendingTimeout   time.Duration
+	Secure           bool
+	RequireTwoFactor func(role Role) bool
+}
+
+// touchEvery limits how often LastSeen is written for a busy session
+const touchEvery = time.Minute
+
+// NewManager returns a Manager that keeps sessions in store and looks up
+/* the signed-in account in users on every request, so role changes take
+   effect straight away. Sessions expire after 30 minutes idle or 12 hours
+   in total
+*/
+func NewManager(store SessionStore, users Users) *Manager {
+	return &Manager{
+		store:          store,
+		users:          users,
+		CookieName:     "grader_session",
+		IdleTimeout:    30 * time.Minute,
+		MaxAge:         12 * time.Hour,
+		PendingTimeout: 5 * time.Minute,
+		Secure:         true,
+	}
+}
+
+// hashToken turns the token held by the browser into the ID it is stored under
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken returns 32 random bytes, URL-safe encoded
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Login starts a session for username and sets its cookie on w. Any
+// session the browser already had, including a pending one, is replaced
+func (m *Manager) Login(w http.ResponseWriter, r *http.Request, username string) error {
+	return m.start(w, r, username, false)
+}
+
+// LoginPending starts a pending session for username, who has given the
+/* right password but must still enter a two-factor code. Call Login once
+   they have
+*/
+func (m *Manager) LoginPending(w http.ResponseWriter, r *http.Request, username string) error {
+	return m.start(w, r, username, true)
+}
+
+// start replaces the browser's session with a new one for username
+func (m *Manager) start(w http.ResponseWriter, r *http.Request, username string, pending bool) error {
+	m.end(r)
+	now := time.Now()
+	if err := m.store.DeleteExpired(now.Add(-m.IdleTimeout), now.Add(-m.MaxAge)); err != nil {
+		log.Println("auth.Login: ", err)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	s := Session{ID: hashToken(token), Username: username, Created: now, LastSeen: now, Pending: pending}
+	if err := m.store.Create(s); err != nil {
+		return err
+	}
+	m.setCookie(w, token, int(m.MaxAge.Seconds()))
+	return nil
+}
+
+// Logout ends the request's session, if it has one, and clears the cookie
+func (m *Manager) Logout(w http.ResponseWriter, r *http.Request) {
+	m.end(r)
+	m.setCookie(w, "", -1)
+}
+
+// user turns an account into the User attached to its requests, holding
+// back its role if the role needs two-factor sign-in and it has none
+func (m *Manager) user(u data.User) User {
+	user := User{Username: u.Username, Role: Role(u.Role)}
+	if !u.TwoFactor && m.RequireTwoFactor != nil && m.RequireTwoFactor(user.Role) {
+		user.Role, user.Restricted = Viewer, true
+	}
+	return user
+}
+
+// EndAll signs username out everywhere by deleting all of their sessions
+func (m *Manager) EndAll(username string) error {
+	return m.store.DeleteUser(username)
+}
+
+// EndOthers signs username out everywhere but the request's own session,
+/* as after a password change. If the request has no session of theirs,
+   every session is ended
+*/
+func (m *Manager) EndOthers(r *http.Request, username string) error {
+	s, ok := m.Session(r)
+	if err := m.store.DeleteUser(username); err != nil {
+		return err
+	}
+	if !ok || s.Username != username {
+		return nil
+	}
+	return m.store.Create(s)
+}
+
+// end deletes the session named by the request's cookie
+func (m *Manager) end(r *http.Request) {
+	cookie, err := r.Cookie(m.CookieName)
+	if err != nil || cookie.Value == "" {
+		return
+	}
+	if err := m.store.Delete(hashToken(cookie.Value)); err != nil {
+		log.Println("auth.Logout: ", err)
+	}
+}
+
+// setCookie writes the session cookie. A negative maxAge deletes it
+func (m *Manager) setCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   m.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// HasCookie returns true if the request carries a session cookie, live or not
+func (m *Manager) HasCookie(r *http.Request) bool {
+	cookie, err := r.Cookie(m.CookieName)
+	return err == nil && cookie.Value != ""
+}
+
+// Session returns the live, signed-in session named by the request's
+/* cookie. Expired sessions are deleted and reported as missing
+ */
+func (m *Manager) Session(r *http.Request) (Session, bool) {
+	s, ok := m.lookup(r)
+	if !ok || s.Pending {
+		return Session{}, false
+	}
+	return s, true
+}
+
+// Pending returns the pending session named by the request's cookie, if
+// the browser is part way through a two-factor sign in
+func (m *Manager) Pending(r *http.Request) (Session, bool) {
+	s, ok := m.lookup(r)
+	if !ok || !s.Pending {
+		return Session{}, false
+	}
+	return s, true
+}
+
+// lookup returns the live session named by the request's cookie
+func (m *Manager) lookup(r *http.Request) (Session, bool) {
+	cookie, err := r.Cookie(m.CookieName)
+	if err != nil || cookie.Value == "" {
+		return Session{}, false
+	}
+	id := hashToken(cookie.Value)
+	s, ok, err := m.store.Get(id)
+	if err != nil {
+		log.Println("auth.Session: ", err)
+		return Session{}, false
+	}
+	if !ok {
+		return Session{}, false
+	}
+
+	now := time.Now()
+	expired := now.Sub(s.LastSeen) > m.IdleTimeout || now.Sub(s.Created) > m.MaxAge
+	if s.Pending && now.Sub(s.Created) > m.PendingTimeout {
+		expired = true
+	}
+	if expired {
+		if err := m.store.Delete(id); err != nil {
+			log.Println("auth.Session: ", err)
+		}
+		return Session{}, false
+	}
+	if now.Sub(s.LastSeen) > touchEvery {
+		if err := m.store.Touch(id, now); err != nil {
+			log.Println("auth.Session: ", err)
+		}
+		s.LastSeen = now
+	}
+	return s, true
+}
+
+// Middleware attaches the signed-in user, if there is one, to every
+/* request so handlers can call CurrentUser. A session whose account no
+   longer exists or has been disabled is treated as signed out. Requests
+   carrying a bearer token are never signed in by cookie, since they skip
+   the CSRF check
+*/
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Bearer(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s, ok := m.Session(r); ok {
+			if u, ok := m.users.GetUser(s.Username); ok && !u.Disabled {
+				r = WithUser(r, m.user(u))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"IngredientGrader/data"
+	"database/sql"
+	"time"
+)
+
+// SQLSessions is a SessionStore backed by the sessions table, so sessions
+/* survive restarts and are shared by every instance using the database.
+   Times are stored as Unix seconds
+*/
+type SQLSessions struct {
+	db *sql.DB
+}
+
+// NewSQLSessions returns a SessionStore that uses db
+func NewSQLSessions(db *sql.DB) *SQLSessions {
+	return &SQLSessions{db: db}
+}
+
+// Create saves a new session
+func (s *SQLSessions) Create(sess Session) error {
+	_, err := s.db.Exec("insert into sessions(id, username, created, last_seen, pending) values(?, ?, ?, ?, ?);",
+		sess.ID, sess.Username, sess.Created.Unix(), sess.LastSeen.Unix(), sess.Pending)
+	return err
+}
+
+// Get returns the session with a matching ID
+func (s *SQLSessions) Get(id string) (Session, bool, error) {
+	var (
+		sess              Session
+		created, lastSeen int64
+	)
+	err := s.db.QueryRow("select id, username, created, last_seen, pending from sessions where id=?;", id).
+		Scan(&sess.ID, &sess.Username, &created, &lastSeen, &sess.Pending)
+	if err == sql.ErrNoRows {
+		return Session{}, false, nil
+	}
+	if err != nil {
+		return Session{}, false, err
+	}
+	sess.Created, sess.LastSeen = time.Unix(created, 0), time.Unix(lastSeen, 0)
+	return sess, true, nil
+}
+
+// Touch records that a session was used at t
+func (s *SQLSessions) Touch(id string, t time.Time) error {
+	_, err := s.db.Exec("update sessions set last_seen=? where id=?;", t.Unix(), id)
+	return err
+}
+
+// Delete removes a session
+func (s *SQLSessions) Delete(id string) error {
+	_, err := s.db.Exec("delete from sessions where id=?;", id)
+	return err
+}
+
+// DeleteExpired removes every session last seen before idle or created
+// before absolute
+func (s *SQLSessions) DeleteExpired(idle, absolute time.Time) error {
+	_, err := s.db.Exec("delete from sessions where last_seen < ? or created < ?;", idle.Unix(), absolute.Unix())
+	return err
+}
+
+// DeleteUser removes every session belonging to username
+func (s *SQLSessions) DeleteUser(username string) error {
+	_, err := s.db.Exec("delete from sessions where username=?;", username)
+	return err
+}
+
+// SQLResets is a ResetStore backed by the password_resets table. Expiry
+// times are stored as Unix seconds
+type SQLResets struct {
+	db *sql.DB
+}
+
+// NewSQLResets returns a ResetStore that uses db
+func NewSQLResets(db *sql.DB) *SQLResets {
+	return &SQLResets{db: db}
+}
+
+// Create saves a new reset
+func (s *SQLResets) Create(r Reset) error {
+	_, err := s.db.Exec("insert into password_resets values(?, ?, ?);", r.ID, r.Username, r.Expires.Unix())
+	return err
+}
+
+// Get returns the reset with a matching ID
+func (s *SQLResets) Get(id string) (Reset, bool, error) {
+	var (
+		r       Reset
+		expires int64
+	)
+	err := s.db.QueryRow("select id, username, expires from password_resets where id=?;", id).
+		Scan(&r.ID, &r.Username, &expires)
+	if err == sql.ErrNoRows {
+		return Reset{}, false, nil
+	}
+	if err != nil {
+		return Reset{}, false, err
+	}
+	r.Expires = time.Unix(expires, 0)
+	return r, true, nil
+}
+
+// Delete removes a reset, reporting whether it was still there
+func (s *SQLResets) Delete(id string) (bool, error) {
+	res, err := s.db.Exec("delete from password_resets where id=?;", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteUser removes every reset for username
+func (s *SQLResets) DeleteUser(username string) error {
+	_, err := s.db.Exec("delete from password_resets where username=?;", username)
+	return err
+}
+
+// DeleteExpired removes every reset that expired before t
+func (s *SQLResets) DeleteExpired(t time.Time) error {
+	_, err := s.db.Exec("delete from password_resets where expires < ?;", t.Unix())
+	return err
+}
+
+// SQLFailures is a FailureStore backed by the login_failures and
+/* lockout_events tables, so every instance using the database counts the
+   same failures. Times are stored as Unix seconds
+*/
+type SQLFailures struct {
+	db *sql.DB
+}
+
+// NewSQLFailures returns a FailureStore that uses db
+func NewSQLFailures(db *sql.DB) *SQLFailures {
+	return &SQLFailures{db: db}
+}
+
+// Get returns the record for subject
+func (s *SQLFailures) Get(subject string) (data.Lockout, bool, error) {
+	var (
+		l                 data.Lockout
+		last, lockedUntil int64
+	)
+	err := s.db.QueryRow("select subject, failures, last_failure, locked_until from login_failures where subject=?;", subject).
+		Scan(&l.Subject, &l.Failures, &last, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return data.Lockout{}, false, nil
+	}
+	if err != nil {
+		return data.Lockout{}, false, err
+	}
+	l.LastFailure, l.LockedUntil = time.Unix(last, 0), time.Unix(lockedUntil, 0)
+	return l, true, nil
+}
+
+// Fail counts a failure for subject at t, forgetting those before since.
+/* The count is incremented by the database, so failures at several
+   instances at once are all counted
+*/
+func (s *SQLFailures) Fail(subject string, t, since time.Time) (data.Lockout, error) {
+	res, err := s.db.Exec("update login_failures set failures = case when last_failure < ? then 1 else failures + 1 end, last_failure=? where subject=?;",
+		since.Unix(), t.Unix(), subject)
+	if err != nil {
+		return data.Lockout{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return data.Lockout{}, err
+	} else if n == 0 {
+		_, err := s.db.Exec("insert into login_failures(subject, failures, last_failure) values(?, 1, ?);", subject, t.Unix())
+		if err != nil {
+			return data.Lockout{}, err
+		}
+	}
+	l, _, err := s.Get(subject)
+	return l, err
+}
+
+// Lock stops subject signing in until until
+func (s *SQLFailures) Lock(subject string, until time.Time) error {
+	_, err := s.db.Exec("update login_failures set locked_until=? where subject=?;", until.Unix(), subject)
+	return err
+}
+
+// Clear forgets every failure and lockout of subject
+func (s *SQLFailures) Clear(subject string) error {
+	_, err := s.db.Exec("delete from login_failures where subject=?;", subject)
+	return err
+}
+
+// ListLocked returns every subject locked out after t, deleting records
+// that are no longer worth keeping
+func (s *SQLFailures) ListLocked(t time.Time) ([]data.Lockout, error) {
+	stale := t.Add(-24 * time.Hour).Unix()
+	if _, err := s.db.Exec("delete from login_failures where last_failure < ? and locked_until < ?;", stale, t.Unix()); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query("select subject, failures, last_failure, locked_until from login_failures where locked_until > ? order by subject;", t.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var locked []data.Lockout
+	for rows.Next() {
+		var (
+			l                 data.Lockout
+			last, lockedUntil int64
+		)
+		if err := rows.Scan(&l.Subject, &l.Failures, &last, &lockedUntil); err != nil {
+			return nil, err
+		}
+		l.LastFailure, l.LockedUntil = time.Unix(last, 0), time.Unix(lockedUntil, 0)
+		locked = append(locked, l)
+	}
+	return locked, rows.Err()
+}
+
+// Record appends an entry to the audit table
+func (s *SQLFailures) Record(e data.LockoutEvent) error {
+	_, err := s.db.Exec("insert into lockout_events(subject, action, actor, failures, at) values(?, ?, ?, ?, ?);",
+		e.Subject, e.Action, e.Actor, e.Failures, e.At.Unix())
+	return err
+}
+
+// ListEvents returns the latest limit entries of the audit table
+func (s *SQLFailures) ListEvents(limit int) ([]data.LockoutEvent, error) {
+	rows, err := s.db.Query("select subject, action, actor, failures, at from lockout_events order by id desc limit ?;", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []data.LockoutEvent
+	for rows.Next() {
+		var (
+			e  data.LockoutEvent
+			at int64
+		)
+		if err := rows.Scan(&e.Subject, &e.Action, &e.Actor, &e.Failures, &at); err != nil {
+			return nil, err
+		}
+		e.At = time.Unix(at, 0)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// SQLTokens is a TokenStore backed by the api_tokens table. Times are
+// stored as Unix seconds, with 0 for a token that has never been used
+type SQLTokens struct {
+	db *sql.DB
+}
+
+// NewSQLTokens returns a TokenStore that uses db
+func NewSQLTokens(db *sql.DB) *SQLTokens {
+	return &SQLTokens{db: db}
+}
+
+// tokenColumns are the columns scanToken reads, in order
+const tokenColumns = "id, hash, username, name, scope, created, last_used"
+
+// scanToken reads a row of tokenColumns
+func scanToken(row interface{ Scan(...interface{}) error }) (data.APIToken, error) {
+	var (
+		t                 data.APIToken
+		created, lastUsed int64
+	)
+	if err := row.Scan(&t.ID, &t.Hash, &t.Username, &t.Name, &t.Scope, &created, &lastUsed); err != nil {
+		return data.APIToken{}, err
+	}
+	t.Created = time.Unix(created, 0)
+	if lastUsed != 0 {
+		t.LastUsed = time.Unix(lastUsed, 0)
+	}
+	return t, nil
+}
+
+// Create saves a new token
+func (s *SQLTokens) Create(t data.APIToken) error {
+	_, err := s.db.Exec("insert into api_tokens("+tokenColumns+") values(?, ?, ?, ?, ?, ?, 0);",
+		t.ID, t.Hash, t.Username, t.Name, t.Scope, t.Created.Unix())
+	return err
+}
+
+// Get returns the token with a matching hash
+func (s *SQLTokens) Get(hash string) (data.APIToken, bool, error) {
+	t, err := scanToken(s.db.QueryRow("select "+tokenColumns+" from api_tokens where hash=?;", hash))
+	if err == sql.ErrNoRows {
+		return data.APIToken{}, false, nil
+	}
+	if err != nil {
+		return data.APIToken{}, false, err
+	}
+	return t, true, nil
+}
+
+// List returns every token belonging to username, oldest first
+func (s *SQLTokens) List(username string) ([]data.APIToken, error) {
+	rows, err := s.db.Query("select "+tokenColumns+" from api_tokens where username=? order by created, id;", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tokens []data.APIToken
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Delete removes username's token with a matching ID
+func (s *SQLTokens) Delete(username, id string) (bool, error) {
+	res, err := s.db.Exec("delete from api_tokens where id=? and username=?;", id, username)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Touch records that the token with a matching hash was used at t
+func (s *SQLTokens) Touch(hash string, t time.Time) error {
+	_, err := s.db.Exec("update api_tokens set last_used=? where hash=?;", t.Unix(), hash)
+	return err
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"IngredientGrader/data"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TokenPrefix starts every API token, so leaked tokens are easy to spot
+const TokenPrefix = "ig_"
+
+// ErrNoToken is returned when revoking a token that does not exist or
+// belongs to someone else
+var ErrNoToken = errors.New("auth: no such API token")
+
+// TokenStore persists API tokens
+type TokenStore interface {
+	// Create saves a new token
+	Create(t data.APIToken) error
+	// Get returns the token with a matching hash. The second value is false
+	// if there is no such token
+	Get(hash string) (data.APIToken, bool, error)
+	// List returns every token belonging to username, oldest first
+	List(username string) ([]data.APIToken, error)
+	// Delete removes the token with a matching ID if it belongs to
+	// username. The second value is false if there was no such token
+	Delete(username, id string) (bool, error)
+	// Touch records that the token with a matching hash was used at t
+	Touch(hash string, t time.Time) error
+}
+
+// Tokens issues, checks and revokes the bearer tokens scripts and apps use
+/* in place of a session cookie. A token acts as its account, with the
+   lower of the account's role and the token's scope, so a read-only token
+   for an admin can only read and lowering an account's role lowers its
+   tokens too. Only the hash of a token is stored, as with session IDs
+*/
+type Tokens struct {
+	store    TokenStore
+	sessions *Manager
+}
+
+// NewTokens returns a Tokens that keeps tokens in store and looks up their
+// accounts the way sessions does
+func NewTokens(store TokenStore, sessions *Manager) *Tokens {
+	return &Tokens{store: store, sessions: sessions}
+}
+
+// Issue makes a new token for username called name, that can act with at
+/* most scope. It returns the token, which cannot be recovered later, and
+   its stored details. Callers check that the user may have scope
+*/
+func (ts *Tokens) Issue(username, name string, scope Role) (string, data.APIToken, error) {
+	random, err := newToken()
+	if err != nil {
+		return "", data.APIToken{}, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", data.APIToken{}, err
+	}
+	token := TokenPrefix + random
+	t := data.APIToken{
+		ID:       hex.EncodeToString(id),
+		Username: username,
+		Name:     name,
+		Scope:    string(scope),
+		Created:  time.Now(),
+		Hash:     hashToken(token),
+	}
+	return token, t, ts.store.Create(t)
+}
+
+// List returns every token belonging to username
+func (ts *Tokens) List(username string) ([]data.APIToken, error) {
+	return ts.store.List(username)
+}
+
+// Revoke deletes username's token with a matching ID. It returns
+// ErrNoToken if they have no such token
+func (ts *Tokens) Revoke(username, id string) error {
+	deleted, err := ts.store.Delete(username, id)
+	if err == nil && !deleted {
+		err = ErrNoToken
+	}
+	return err
+}
+
+// bearerToken returns the token in the request's Authorization header
+func bearerToken(r *http.Request) string {
+	return strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+}
+
+// lookup returns the user a request's bearer token acts as, recording that
+// the token was used
+func (ts *Tokens) lookup(r *http.Request) (User, bool) {
+	token := bearerToken(r)
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return User{}, false
+	}
+	hash := hashToken(token)
+	t, ok, err := ts.store.Get(hash)
+	if err != nil {
+		log.Println("auth.Tokens: ", err)
+		return User{}, false
+	}
+	if !ok {
+		return User{}, false
+	}
+	account, ok := ts.sessions.users.GetUser(t.Username)
+	if !ok || account.Disabled {
+		return User{}, false
+	}
+
+	now := time.Now()
+	if now.Sub(t.LastUsed) > touchEvery {
+		if err := ts.store.Touch(hash, now); err != nil {
+			log.Println("auth.Tokens: ", err)
+		}
+	}
+	u := ts.sessions.user(account)
+	if !u.Role.Allows(Role(t.Scope)) {
+		return u, true
+	}
+	u.Role = Role(t.Scope)
+	return u, true
+}
+
+// Middleware attaches the user a request's bearer token acts as, so the
+/* same role checks apply as for signed-in users. Unknown, revoked and
+   disabled accounts' tokens leave the request signed out. Put it after
+   Manager.Middleware, which leaves bearer requests alone
+*/
+func (ts *Tokens) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Bearer(r) {
+			if u, ok := ts.lookup(r); ok {
+				r = WithUser(r, u)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientKey names who a request comes from, for limits that apply per
+/* client: the API token for requests signed in with one, the username for
+   requests signed in with a session, and otherwise the client's address.
+   Tokens are hashed so the key can be kept without keeping the token
+*/
+func ClientKey(r *http.Request) string {
+	u, ok := CurrentUser(r)
+	if !ok {
+		return "ip:" + ClientIP(r)
+	}
+	if Bearer(r) {
+		return "token:" + hashToken(bearerToken(r))
+	}
+	return "user:" + u.Username
+}
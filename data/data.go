@@ -2,36 +2,194 @@ package data
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	// To prevent this from escaping
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 // Food is a struct that contains the information of a single Food
 /*	Barcode - The UPC-A code of the food. The barcode of the food must be unique
 	Name - The name of the food
-	Ingredients - A comma separated list of all the ingredients of the food
+	Label - The ingredient statement as it was entered, kept for display
+	Ingredients - The top-level ingredients of the food in label order, each
+	with its sub-ingredients. Each Grade is -10 if the ingredient has not
+	been graded yet
 	Grade - The categorical grade of the food - Very Bad, Bad, Neutral, Good, Very Good
 	NumGrade - The numerical grade of the food. This is a floating point number between -5
 	and 5, inclusive.
 */
 type Food struct {
-	Barcode     string  `json:"barcode"`
-	Name        string  `json:"title"`
-	Ingredients string  `json:"ingredients"`
-	Grade       string  `json:"grade"`
-	NumGrade    float64 `json:"numgrade"`
+	Barcode     string       `json:"barcode"`
+	Name        string       `json:"title"`
+	Label       string       `json:"label"`
+	Ingredients []Ingredient `json:"ingredients"`
+	Grade       string       `json:"grade"`
+	NumGrade    float64      `json:"numgrade"`
 }
 
 // Ingredient is a struct that contains the information of a single ingredient
 /*	Name - The name of the Ingredient. The name of the ingredient must be unique
 	Grade - The grade of the Ingredient. This is a int between -5 and 5, inclusive
+	Weight - The share of a food's grade this ingredient accounts for, from 0
+	to 1. Only set when the ingredient is listed as part of a graded food
+	Canonical - The ingredient Name is an alias of, whose grade Grade is.
+	Empty if Name is not an alias
+	Percent - The share of the food it makes up according to the label, from
+	0 to 100. 0 if the label does not say
+	OrLess - Whether the label lists it under "contains 2% or less of", in
+	which case Percent is the most it can be
+	Alternatives - Whether Children are alternatives, as in "soybean and/or
+	canola oil", rather than the parts of a compound
+	Children - The sub-ingredients the label lists in brackets after it, in
+	label order, or its alternatives
+	Derived - Whether Grade was worked out from Children because the
+	ingredient has no grade of its own
 */
 type Ingredient struct {
-	Name  string `json:"title"`
-	Grade int    `json:"grade"`
+	Name         string       `json:"title"`
+	Grade        int          `json:"grade"`
+	Weight       float64      `json:"weight,omitempty"`
+	Canonical    string       `json:"canonical,omitempty"`
+	Percent      float64      `json:"percent,omitempty"`
+	OrLess       bool         `json:"or_less,omitempty"`
+	Alternatives bool         `json:"alternatives,omitempty"`
+	Children     []Ingredient `json:"children,omitempty"`
+	Derived      bool         `json:"derived,omitempty"`
+}
+
+// CanonicalName returns the name of the ingredient i is graded as, which
+// is Canonical if i was found through an alias and Name otherwise
+func (i Ingredient) CanonicalName() string {
+	if i.Canonical != "" {
+		return i.Canonical
+	}
+	return i.Name
+}
+
+// Share formats Weight as a percentage for the /food results table
+func (i Ingredient) Share() string {
+	return fmt.Sprintf("%.1f%%", i.Weight*100)
+}
+
+// Amount formats Percent as the label gave it, such as "10%" or "2% or
+// less". Empty if the label does not say
+func (i Ingredient) Amount() string {
+	if i.Percent == 0 {
+		return ""
+	}
+	amount := strconv.FormatFloat(i.Percent, 'f', -1, 64) + "%"
+	if i.OrLess {
+		amount += " or less"
+	}
+	return amount
+}
+
+// MissingIngredient is an ungraded ingredient waiting to be triaged
+/*	Name - The ingredient's name as it was read from food labels
+	Count - How many times it has been recorded as missing
+	Foods - The foods that cannot be graded until it is
+	Suggestions - Graded ingredients it may be another name for, best first
+*/
+type MissingIngredient struct {
+	Name        string       `json:"title"`
+	Count       int          `json:"count"`
+	Foods       []Food       `json:"foods"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// Suggestion is a graded ingredient a missing one may be another name for
+/*	Name - The graded ingredient's name
+	Score - How alike the names are, from 0 to 1
+*/
+type Suggestion struct {
+	Name  string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+// Percent formats Score as a percentage for the pages
+func (s Suggestion) Percent() string {
+	return fmt.Sprintf("%.0f%%", s.Score*100)
+}
+
+// Alias is another name for a graded ingredient, such as "cane sugar" for
+/* "sugar". Foods that list the alias are graded as if they listed the
+   ingredient
+	Name - The alternate name, lowercase
+	Ingredient - The name of the ingredient it stands for
+*/
+type Alias struct {
+	Name       string `json:"alias"`
+	Ingredient string `json:"ingredient"`
+}
+
+// User is a struct that contains the public information of an account
+/*	Username - The name the user signs in with. Usernames must be unique
+	Role - What the user may do: viewer, contributor, grader or admin
+	Disabled - Disabled accounts cannot sign in, and their sessions stop working
+	Email - Where password reset links are sent. May be empty
+	TwoFactor - Whether signing in also needs a code from an authenticator app
+*/
+type User struct {
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Disabled  bool   `json:"disabled"`
+	Email     string `json:"email,omitempty"`
+	TwoFactor bool   `json:"two_factor"`
+}
+
+// TOTP is an account's two-factor sign-in state
+/*	Secret - The base32 secret shared with the user's authenticator app. It
+	is set when enrollment starts, before the app has been checked
+	Enabled - Whether sign in needs a code. Only true once the user has
+	entered a code from the app
+	LastStep - The time step of the last code accepted, so a code cannot be
+	used twice
+*/
+type TOTP struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// TwoFactor is the two-factor sign-in state printed to the account page
+/*	Enabled - Whether the account signs in with a code
+	Required - Whether the account's role must use two-factor sign-in
+	Secret - The secret to type into an app that cannot scan the QR code
+	URI - The provisioning URI the QR code holds
+	RecoveryCodes - Newly made recovery codes, shown once
+	CodesLeft - How many unused recovery codes the account has
+*/
+type TwoFactor struct {
+	Enabled       bool     `json:"enabled"`
+	Required      bool     `json:"required"`
+	Secret        string   `json:"secret,omitempty"`
+	URI           string   `json:"uri,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	CodesLeft     int      `json:"codes_left"`
+}
+
+// Job is a background job printed to the page
+/*	Name - What the job does, such as "regrade all foods"
+	State - queued, running, finished, failed or cancelled
+	Total - How many items it has to process, 0 until it knows
+	Done - How many items it has processed
+	Failed - How many of those could not be processed
+	Error - Why the job failed, if it did
+*/
+type Job struct {
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Total  int    `json:"total"`
+	Done   int    `json:"done"`
+	Failed int    `json:"failed"`
+	Error  string `json:"error,omitempty"`
 }
 
 // Content is a struct that contains any dynamic information that is printed
@@ -49,13 +207,151 @@ Content struct.
 	are defined, only PageErrors should be used if errors exist
 	Success - If no errors were thrown, Success is true
 	Source - The handling function that was executed associated with this struct
+	PageJobs - Background jobs to be printed to the page, newest first
+	CurrentUser - The username of the signed-in user, empty if nobody is
+	signed in
+	CurrentRole - The role of the signed-in user
+	PageUsers - The accounts to be printed to the page
+	PageTwoFactor - The signed-in user's two-factor sign-in state, for the
+	account pages
+	Settings - Site-wide settings, for the admin pages
+	CSRFToken - The token every form that POSTs must send back in its
+	csrf_token field
+	PageLockouts - Locked out usernames and addresses, for the admin pages
+	PageLockoutEvents - Recent lockout audit entries, for the admin pages
+	PageTokens - The signed-in user's API tokens
+	NewToken - A token that was just made, shown once so it can be copied
+	PageFoods - Foods to list, such as those using an ingredient about to
+	be deleted
+	PageAudit - Audit log entries, for the admin pages
+	AuditFilter - The filter PageAudit was picked with
+	PageMissing - Ingredients waiting to be triaged, for the grader pages
+	PageAliases - Ingredient aliases, for the admin pages
 */
 type Content struct {
-	PageFood        Food         `json:"food"`
-	PageIngredients []Ingredient `json:"ingredients"`
-	PageErrors      []string     `json:"errors"`
-	Success         bool         `json:"success"`
-	Source          string       `json:"source"`
+	PageFood          Food                `json:"food"`
+	PageIngredients   []Ingredient        `json:"ingredients"`
+	PageErrors        []string            `json:"errors"`
+	Success           bool                `json:"success"`
+	Source            string              `json:"source"`
+	PageJobs          []Job               `json:"jobs,omitempty"`
+	CurrentUser       string              `json:"user,omitempty"`
+	CurrentRole       string              `json:"role,omitempty"`
+	PageUsers         []User              `json:"users,omitempty"`
+	PageTwoFactor     *TwoFactor          `json:"two_factor,omitempty"`
+	Settings          *Settings           `json:"settings,omitempty"`
+	CSRFToken         string              `json:"-"`
+	PageLockouts      []Lockout           `json:"lockouts,omitempty"`
+	PageLockoutEvents []LockoutEvent      `json:"lockout_events,omitempty"`
+	PageTokens        []APIToken          `json:"tokens,omitempty"`
+	NewToken          string              `json:"-"`
+	PageFoods         []Food              `json:"foods,omitempty"`
+	PageAudit         []AuditEntry        `json:"audit,omitempty"`
+	AuditFilter       *AuditFilter        `json:"audit_filter,omitempty"`
+	PageMissing       []MissingIngredient `json:"missing,omitempty"`
+	PageAliases       []Alias             `json:"aliases,omitempty"`
+}
+
+// APIToken is a bearer token a user made for a script or app
+/*	ID - The token's public identifier, used to revoke it
+	Username - The account the token acts as
+	Name - What the user called the token
+	Scope - The highest role the token can act with, whatever the role of
+	its account
+	Created - When it was made
+	LastUsed - When it was last used, zero if never
+	Hash - The hash the token is looked up by. The token itself is only
+	shown once, when it is made
+*/
+type APIToken struct {
+	ID       string    `json:"id"`
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
+	Scope    string    `json:"scope"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+	Hash     string    `json:"-"`
+}
+
+// AuditEntry is a line of the audit log, written whenever the catalog or
+/* an account changes or someone signs in. Entries are never changed or
+   deleted once written
+	ID - The entry's position in the log
+	At - When it happened
+	Actor - Who did it: a username, or cli for the command line
+	Action - What they did: create, update, delete, regrade, role,
+	password or login
+	Entity - What kind of thing it was done to: food, ingredient, user or
+	settings
+	EntityID - Which one: a barcode, ingredient name or username
+	Before - The entity as JSON before the change, absent for creations
+	After - The entity as JSON after the change, absent for deletions
+*/
+type AuditEntry struct {
+	ID       int64           `json:"id"`
+	At       time.Time       `json:"at"`
+	Actor    string          `json:"actor"`
+	Action   string          `json:"action"`
+	Entity   string          `json:"entity"`
+	EntityID string          `json:"entity_id"`
+	Before   json.RawMessage `json:"before,omitempty"`
+	After    json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditFilter picks entries out of the audit log. Empty fields match
+/* every entry
+	Entity, EntityID, Actor - Must equal the entry's field
+	Before - Only entries older than this ID, for paging back
+	Limit - The most entries to return, newest first
+*/
+type AuditFilter struct {
+	Entity   string `json:"entity"`
+	EntityID string `json:"entity_id"`
+	Actor    string `json:"actor"`
+	Before   int64  `json:"before"`
+	Limit    int    `json:"limit"`
+}
+
+// Lockout is the failed sign-in record of a username or address
+/*	Subject - What failed to sign in: "user:" followed by a username, or
+	"ip:" followed by an address
+	Failures - How many sign-ins failed in a row
+	LastFailure - When the last one failed
+	LockedUntil - When sign-ins are allowed again, if Subject is locked out
+*/
+type Lockout struct {
+	Subject     string    `json:"subject"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LockoutEvent is an entry in the lockout audit table
+/*	Subject - The username or address, as in Lockout
+	Action - locked when too many sign-ins failed, unlocked when an admin
+	lifted the lockout
+	Actor - The admin who unlocked, empty for lockouts
+	Failures - How many sign-ins had failed
+	At - When it happened
+*/
+type LockoutEvent struct {
+	Subject  string    `json:"subject"`
+	Action   string    `json:"action"`
+	Actor    string    `json:"actor,omitempty"`
+	Failures int       `json:"failures"`
+	At       time.Time `json:"at"`
+}
+
+// Settings are the site-wide options admins can change while the site runs
+/*	RequireAdminTwoFactor - Whether admin accounts must use two-factor
+	sign-in before they can use their role
+	AutoMatch - How alike, from 0 to 1, an unknown ingredient of a new food
+	must be to a graded one to become its alias automatically. 0 turns
+	automatic matching off
+*/
+type Settings struct {
+	RequireAdminTwoFactor bool    `json:"require_admin_two_factor"`
+	AutoMatch             float64 `json:"auto_match"`
 }
 
 // AddError adds an error to the PageErrors slice in a Content object
@@ -80,19 +376,53 @@ func (c *Content) AddIngredient(ingred Ingredient) {
 // DB is a database handle that will be used to read and write data to/from the database
 var DB *sql.DB
 
+// Driver is the database/sql driver DB was opened with, either "mysql" or
+// "sqlite3". It is empty until Init has been called
+var Driver string
+
 // Init must be called before anything else in main.go to establish connection
 /* to the database. If this is not done, no webpage will work correctly. functions
    in admin and server packages will not work correctly without this being run first
+   The backend is chosen with GRADER_DB:
+	  - mysql (the default) connects using GRADER_USER, GRADER_PASS and GRADER_LOC
+	  - sqlite opens the file named by GRADER_DB_PATH (grader.db if unset)
+   MySQL connections count the rows an update matched, not those it changed.
+   Init does not touch the schema; see MigrateUp
 */
 func Init() error {
+	switch os.Getenv("GRADER_DB") {
+	case "", "mysql":
+		creds := fmt.Sprintf("%s:%s@%s", os.Getenv("GRADER_USER"), os.Getenv("GRADER_PASS"), os.Getenv("GRADER_LOC"))
+		// Report the rows an update matched rather than those it changed, as
+		// SQLite does, so saving unchanged values is not taken as not found
+		sep := "?"
+		if strings.Contains(creds, "?") {
+			sep = "&"
+		}
+		return open("mysql", creds+sep+"clientFoundRows=true")
+	case "sqlite":
+		path := os.Getenv("GRADER_DB_PATH")
+		if path == "" {
+			path = "grader.db"
+		}
+		dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on", path)
+		return open("sqlite3", dsn)
+	default:
+		return fmt.Errorf("data.Init: unknown GRADER_DB %q", os.Getenv("GRADER_DB"))
+	}
+}
+
+// open connects to the database and checks that it responds before
+// assigning it to DB
+func open(driver, dsn string) error {
 	// First open the connection
-	creds := fmt.Sprintf("%s:%s@%s", os.Getenv("GRADER_USER"), os.Getenv("GRADER_PASS"), os.Getenv("GRADER_LOC"))
-	tempdb, err := sql.Open("mysql", creds)
+	tempdb, err := sql.Open(driver, dsn)
 	if err != nil {
 		return err
 	}
 	// If all checks out, assign it to DB
 	DB = tempdb
+	Driver = driver
 	// Now check if it works
 	err = DB.Ping()
 	if err != nil {
@@ -0,0 +1,234 @@
+package data
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema for every supported driver. Each driver
+/* has its own directory named after it (mysql, sqlite3) containing pairs of
+   NNNN_name.up.sql and NNNN_name.down.sql files
+*/
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a single versioned change to the schema
+/*	Version - The number the file names start with. Migrations are applied
+	in ascending order of Version
+	Name - The rest of the file name, for display only
+	Up - The statements that apply the change
+	Down - The statements that revert the change
+	AppliedAt - When the migration was applied, or the zero time if it is pending
+*/
+type Migration struct {
+	Version   int
+	Name      string
+	Up        string
+	Down      string
+	AppliedAt time.Time
+}
+
+// Applied returns true if the migration has been recorded in schema_migrations
+func (m Migration) Applied() bool {
+	return !m.AppliedAt.IsZero()
+}
+
+const createMigrationsTable = `create table if not exists schema_migrations (
+	version    integer primary key,
+	applied_at varchar(32) not null
+)`
+
+// Migrations returns every migration for the current driver, ordered by
+/* version, with AppliedAt filled in for the ones already applied. Init must
+   have been called first
+*/
+func Migrations() ([]Migration, error) {
+	list, err := loadMigrations(Driver)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := DB.Exec(createMigrationsTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query("select version, applied_at from schema_migrations;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version int
+			at      string
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version], _ = time.Parse(time.RFC3339, at)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		list[i].AppliedAt = applied[list[i].Version]
+	}
+	return list, nil
+}
+
+// MigrateUp applies every pending migration in order and returns the ones
+// it applied
+func MigrateUp() ([]Migration, error) {
+	list, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, m := range list {
+		if m.Applied() {
+			continue
+		}
+		err := runMigration(m.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec("insert into schema_migrations values(?, ?);", m.Version, time.Now().UTC().Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, newest first,
+// until steps migrations have been reverted or none are left
+func MigrateDown(steps int) ([]Migration, error) {
+	list, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(list) - 1; i >= 0 && len(done) < steps; i-- {
+		m := list[i]
+		if !m.Applied() {
+			continue
+		}
+		err := runMigration(m.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec("delete from schema_migrations where version=?;", m.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// runMigration executes the statements in script and then calls record inside
+/* a single transaction. MySQL commits DDL implicitly, so on MySQL a failure
+   part way through a script can still leave earlier statements applied
+*/
+func runMigration(script string, record func(*sql.Tx) error) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// splitStatements breaks a script into single statements, since the MySQL
+/* driver refuses to run more than one per Exec. A statement ends at a line
+   whose last character is a semicolon
+*/
+func splitStatements(script string) []string {
+	var (
+		stmts []string
+		cur   strings.Builder
+	)
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, cur.String())
+			cur.Reset()
+		}
+	}
+	if strings.TrimSpace(cur.String()) != "" {
+		stmts = append(stmts, cur.String())
+	}
+	return stmts
+}
+
+// loadMigrations reads the embedded migration files for driver
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		file := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("bad migration file name %q", file)
+		}
+		body, err := migrationFiles.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
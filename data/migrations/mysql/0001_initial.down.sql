@@ -0,0 +1,4 @@
+drop table if exists users;
+drop table if exists missing;
+drop table if exists ingredients;
+drop table if exists food;
@@ -0,0 +1,21 @@
+create table if not exists food (
+	barcode     varchar(32) primary key,
+	title       varchar(255) not null,
+	ingredients text not null,
+	grade       varchar(16) not null,
+	numgrade    double not null
+);
+
+create table if not exists ingredients (
+	title varchar(255) primary key,
+	grade int not null
+);
+
+create table if not exists missing (
+	name varchar(255) not null
+);
+
+create table if not exists users (
+	username   varchar(64) primary key,
+	hashedPass varchar(255) not null
+);
@@ -0,0 +1 @@
+drop table if exists food_ingredients;
@@ -0,0 +1,21 @@
+create table food_ingredients (
+	barcode    varchar(32) not null,
+	position   int not null,
+	ingredient varchar(255) not null,
+	primary key (barcode, position),
+	index food_ingredients_ingredient (ingredient),
+	foreign key (barcode) references food(barcode) on delete cascade
+);
+
+-- Split the comma-separated food.ingredients column into ordered rows
+insert into food_ingredients (barcode, position, ingredient)
+with recursive split(barcode, n, item, rest) as (
+	select barcode, 0, cast('' as char(255)), cast(concat(ingredients, ',') as char(4096)) from food
+	union all
+	select barcode, n + 1,
+		lower(trim(substring(rest, 1, locate(',', rest) - 1))),
+		substring(rest, locate(',', rest) + 1)
+	from split where rest <> ''
+)
+select barcode, row_number() over (partition by barcode order by n) - 1, item
+from split where n > 0 and item <> '';
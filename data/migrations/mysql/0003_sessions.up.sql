@@ -0,0 +1,7 @@
+create table sessions (
+	id        char(64) primary key,
+	username  varchar(64) not null,
+	created   bigint not null,
+	last_seen bigint not null,
+	index sessions_username (username)
+);
@@ -0,0 +1,8 @@
+alter table users add column email varchar(254) not null default '';
+
+create table password_resets (
+	id       char(64) primary key,
+	username varchar(64) not null,
+	expires  bigint not null,
+	index password_resets_username (username)
+);
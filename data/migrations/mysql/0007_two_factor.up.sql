@@ -0,0 +1,15 @@
+alter table users add column totp_secret varchar(64) not null default '';
+alter table users add column totp_enabled boolean not null default false;
+alter table users add column totp_last bigint not null default 0;
+alter table sessions add column pending boolean not null default false;
+
+create table recovery_codes (
+	username varchar(64) not null,
+	code     char(64) not null,
+	primary key (username, code)
+);
+
+create table settings (
+	name  varchar(64) primary key,
+	value varchar(255) not null
+);
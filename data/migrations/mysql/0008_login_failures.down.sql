@@ -0,0 +1,2 @@
+drop table lockout_events;
+drop table login_failures;
@@ -0,0 +1,15 @@
+create table login_failures (
+	subject      varchar(128) primary key,
+	failures     int not null,
+	last_failure bigint not null,
+	locked_until bigint not null default 0
+);
+
+create table lockout_events (
+	id       bigint auto_increment primary key,
+	subject  varchar(128) not null,
+	action   varchar(16) not null,
+	actor    varchar(64) not null,
+	failures int not null,
+	at       bigint not null
+);
@@ -0,0 +1,10 @@
+create table api_tokens (
+	id        varchar(16) primary key,
+	hash      char(64) not null unique,
+	username  varchar(64) not null,
+	name      varchar(64) not null,
+	scope     varchar(16) not null,
+	created   bigint not null,
+	last_used bigint not null default 0,
+	index api_tokens_username (username)
+);
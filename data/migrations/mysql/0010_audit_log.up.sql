@@ -0,0 +1,12 @@
+create table audit_log (
+	id           bigint auto_increment primary key,
+	at           bigint not null,
+	actor        varchar(64) not null,
+	action       varchar(16) not null,
+	entity       varchar(16) not null,
+	entity_id    varchar(255) not null,
+	before_state text not null,
+	after_state  text not null,
+	index audit_log_entity (entity, entity_id),
+	index audit_log_actor (actor)
+);
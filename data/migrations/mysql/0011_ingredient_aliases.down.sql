@@ -0,0 +1 @@
+drop table ingredient_aliases;
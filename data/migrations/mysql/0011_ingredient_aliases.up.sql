@@ -0,0 +1,5 @@
+create table ingredient_aliases (
+	alias      varchar(255) primary key,
+	ingredient varchar(255) not null,
+	index ingredient_aliases_ingredient (ingredient)
+);
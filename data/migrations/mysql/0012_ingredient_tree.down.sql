@@ -0,0 +1,6 @@
+delete from food_ingredients where parent <> -1;
+alter table food_ingredients
+	drop column alternatives,
+	drop column or_less,
+	drop column percent,
+	drop column parent;
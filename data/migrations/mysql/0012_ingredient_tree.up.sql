@@ -0,0 +1,7 @@
+-- Rows whose parent is another row's position are that ingredient's
+-- sub-ingredients; top-level ingredients have a parent of -1
+alter table food_ingredients
+	add column parent int not null default -1,
+	add column percent double not null default 0,
+	add column or_less tinyint(1) not null default 0,
+	add column alternatives tinyint(1) not null default 0;
@@ -0,0 +1,3 @@
+alter table missing
+	drop index missing_barcode,
+	drop column barcode;
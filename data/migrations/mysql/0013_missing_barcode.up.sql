@@ -0,0 +1,5 @@
+-- The food each row was recorded for, so deleting a food clears its rows.
+-- Rows recorded before this migration have an empty barcode
+alter table missing
+	add column barcode varchar(32) not null default '',
+	add index missing_barcode (barcode);
@@ -0,0 +1,21 @@
+create table if not exists food (
+	barcode     text primary key,
+	title       text not null,
+	ingredients text not null,
+	grade       text not null,
+	numgrade    real not null
+);
+
+create table if not exists ingredients (
+	title text primary key,
+	grade integer not null
+);
+
+create table if not exists missing (
+	name text not null
+);
+
+create table if not exists users (
+	username   text primary key,
+	hashedPass text not null
+);
@@ -0,0 +1,21 @@
+create table food_ingredients (
+	barcode    text not null references food(barcode) on delete cascade,
+	position   integer not null,
+	ingredient text not null,
+	primary key (barcode, position)
+);
+
+create index food_ingredients_ingredient on food_ingredients(ingredient);
+
+-- Split the comma-separated food.ingredients column into ordered rows
+insert into food_ingredients (barcode, position, ingredient)
+with recursive split(barcode, n, item, rest) as (
+	select barcode, 0, '', ingredients || ',' from food
+	union all
+	select barcode, n + 1,
+		lower(trim(substr(rest, 1, instr(rest, ',') - 1))),
+		substr(rest, instr(rest, ',') + 1)
+	from split where rest <> ''
+)
+select barcode, row_number() over (partition by barcode order by n) - 1, item
+from split where n > 0 and item <> '';
@@ -0,0 +1,8 @@
+create table sessions (
+	id        text primary key,
+	username  text not null,
+	created   integer not null,
+	last_seen integer not null
+);
+
+create index sessions_username on sessions(username);
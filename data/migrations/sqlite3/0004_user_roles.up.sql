@@ -0,0 +1 @@
+alter table users add column role varchar(16) not null default 'viewer';
@@ -0,0 +1 @@
+alter table users add column disabled integer not null default 0;
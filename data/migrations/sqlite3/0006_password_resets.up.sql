@@ -0,0 +1,9 @@
+alter table users add column email text not null default '';
+
+create table password_resets (
+	id       text primary key,
+	username text not null,
+	expires  integer not null
+);
+
+create index password_resets_username on password_resets(username);
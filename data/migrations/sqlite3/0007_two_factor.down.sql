@@ -0,0 +1,6 @@
+drop table settings;
+drop table recovery_codes;
+alter table sessions drop column pending;
+alter table users drop column totp_last;
+alter table users drop column totp_enabled;
+alter table users drop column totp_secret;
@@ -0,0 +1,15 @@
+alter table users add column totp_secret text not null default '';
+alter table users add column totp_enabled integer not null default 0;
+alter table users add column totp_last integer not null default 0;
+alter table sessions add column pending integer not null default 0;
+
+create table recovery_codes (
+	username text not null,
+	code     text not null,
+	primary key (username, code)
+);
+
+create table settings (
+	name  text primary key,
+	value text not null
+);
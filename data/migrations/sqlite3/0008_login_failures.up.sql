@@ -0,0 +1,15 @@
+create table login_failures (
+	subject      text primary key,
+	failures     integer not null,
+	last_failure integer not null,
+	locked_until integer not null default 0
+);
+
+create table lockout_events (
+	id       integer primary key autoincrement,
+	subject  text not null,
+	action   text not null,
+	actor    text not null,
+	failures integer not null,
+	at       integer not null
+);
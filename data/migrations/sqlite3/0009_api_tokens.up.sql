@@ -0,0 +1,11 @@
+create table api_tokens (
+	id        text primary key,
+	hash      text not null unique,
+	username  text not null,
+	name      text not null,
+	scope     text not null,
+	created   integer not null,
+	last_used integer not null default 0
+);
+
+create index api_tokens_username on api_tokens(username);
@@ -0,0 +1,13 @@
+create table audit_log (
+	id           integer primary key autoincrement,
+	at           integer not null,
+	actor        text not null,
+	action       text not null,
+	entity       text not null,
+	entity_id    text not null,
+	before_state text not null,
+	after_state  text not null
+);
+
+create index audit_log_entity on audit_log(entity, entity_id);
+create index audit_log_actor on audit_log(actor);
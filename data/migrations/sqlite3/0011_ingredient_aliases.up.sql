@@ -0,0 +1,6 @@
+create table ingredient_aliases (
+	alias      text primary key,
+	ingredient text not null
+);
+
+create index ingredient_aliases_ingredient on ingredient_aliases(ingredient);
@@ -0,0 +1,5 @@
+delete from food_ingredients where parent <> -1;
+alter table food_ingredients drop column alternatives;
+alter table food_ingredients drop column or_less;
+alter table food_ingredients drop column percent;
+alter table food_ingredients drop column parent;
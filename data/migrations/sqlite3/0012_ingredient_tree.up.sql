@@ -0,0 +1,6 @@
+-- Rows whose parent is another row's position are that ingredient's
+-- sub-ingredients; top-level ingredients have a parent of -1
+alter table food_ingredients add column parent integer not null default -1;
+alter table food_ingredients add column percent real not null default 0;
+alter table food_ingredients add column or_less integer not null default 0;
+alter table food_ingredients add column alternatives integer not null default 0;
@@ -0,0 +1,2 @@
+drop index missing_barcode;
+alter table missing drop column barcode;
@@ -0,0 +1,4 @@
+-- The food each row was recorded for, so deleting a food clears its rows.
+-- Rows recorded before this migration have an empty barcode
+alter table missing add column barcode text not null default '';
+create index missing_barcode on missing (barcode);
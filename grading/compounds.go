@@ -0,0 +1,118 @@
+package grading
+
+import (
+	"IngredientGrader/data"
+	"fmt"
+	"math"
+)
+
+// Rule works out the grade of a compound ingredient, such as "chocolate
+/* chips (sugar, chocolate, cocoa butter)", from the grades of its
+   sub-ingredients, given in label order. It returns the ungraded grade when
+   the children do not settle it
+*/
+type Rule func(children []data.Ingredient) int
+
+// AverageRule grades a compound with the rounded mean of its children. A
+// compound with any ungraded child stays ungraded
+func AverageRule(children []data.Ingredient) int {
+	if len(children) == 0 {
+		return ungraded
+	}
+	var total int
+	for _, in := range children {
+		if in.Grade == ungraded {
+			return ungraded
+		}
+		total += in.Grade
+	}
+	return int(math.Round(float64(total) / float64(len(children))))
+}
+
+// WorstRule grades a compound with its worst child. A compound with any
+// ungraded child stays ungraded
+func WorstRule(children []data.Ingredient) int {
+	if len(children) == 0 {
+		return ungraded
+	}
+	worst := children[0].Grade
+	for _, in := range children {
+		if in.Grade == ungraded {
+			return ungraded
+		}
+		if in.Grade < worst {
+			worst = in.Grade
+		}
+	}
+	return worst
+}
+
+// FirstRule grades a compound with its first child, which labels list as
+// the one it contains the most of
+func FirstRule(children []data.Ingredient) int {
+	if len(children) == 0 {
+		return ungraded
+	}
+	return children[0].Grade
+}
+
+// RuleByName returns the compound rule called name. "none" returns a nil
+// Rule, which leaves compounds without a grade of their own ungraded
+func RuleByName(name string) (Rule, error) {
+	switch name {
+	case "", "average":
+		return AverageRule, nil
+	case "worst":
+		return WorstRule, nil
+	case "first":
+		return FirstRule, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("grading: unknown compound rule %q", name)
+}
+
+// Fill returns a copy of ingredients in which every ungraded compound is
+/* given the grade rule works out from its children and marked Derived.
+   Children are filled first, so compounds nested in compounds are graded
+   from the bottom up. A nil rule fills nothing
+*/
+func Fill(ingredients []data.Ingredient, rule Rule) []data.Ingredient {
+	if ingredients == nil {
+		return nil
+	}
+	filled := make([]data.Ingredient, len(ingredients))
+	for i, in := range ingredients {
+		in.Children = Fill(in.Children, rule)
+		if rule != nil && in.Grade == ungraded && len(in.Children) > 0 {
+			in.Grade = rule(in.Children)
+			in.Derived = in.Grade != ungraded
+		}
+		filled[i] = in
+	}
+	return filled
+}
+
+// Compounds grades foods with Strategy after filling in the grades of
+/* compound ingredients with Rule, so a compound with no grade of its own
+   does not leave the food missing once its children are graded
+*/
+type Compounds struct {
+	Strategy Strategy
+	Rule     Rule
+}
+
+// Name returns the name of the wrapped strategy
+func (c Compounds) Name() string { return c.Strategy.Name() }
+
+// Grade fills in the compounds' grades and grades the result with Strategy
+func (c Compounds) Grade(ingredients []data.Ingredient) Result {
+	return c.Strategy.Grade(Fill(ingredients, c.Rule))
+}
+
+// Fills reports whether strategy grades compound ingredients from their
+// sub-ingredients, so a compound need not be graded itself
+func Fills(strategy Strategy) bool {
+	c, ok := strategy.(Compounds)
+	return ok && c.Rule != nil
+}
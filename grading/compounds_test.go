@@ -0,0 +1,120 @@
+package grading
+
+import (
+	"IngredientGrader/data"
+	"testing"
+)
+
+// compound returns an ungraded ingredient with children
+func compound(name string, children ...data.Ingredient) data.Ingredient {
+	return data.Ingredient{Name: name, Grade: ungraded, Children: children}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		children []data.Ingredient
+		average  int
+		worst    int
+		first    int
+	}{
+		{"no children", nil, ungraded, ungraded, ungraded},
+		{"one child", graded(3), 3, 3, 3},
+		{"rounded", graded(2, 3), 3, 2, 2},
+		{"negative", graded(-1, -4, 1), -1, -4, -1},
+		{"ungraded child", graded(4, ungraded), ungraded, ungraded, 4},
+		{"ungraded first child", graded(ungraded, 4), ungraded, ungraded, ungraded},
+	}
+	for _, tt := range tests {
+		if got := AverageRule(tt.children); got != tt.average {
+			t.Errorf("%s: AverageRule = %d, want %d", tt.name, got, tt.average)
+		}
+		if got := WorstRule(tt.children); got != tt.worst {
+			t.Errorf("%s: WorstRule = %d, want %d", tt.name, got, tt.worst)
+		}
+		if got := FirstRule(tt.children); got != tt.first {
+			t.Errorf("%s: FirstRule = %d, want %d", tt.name, got, tt.first)
+		}
+	}
+}
+
+func TestRuleByName(t *testing.T) {
+	tests := []struct {
+		name string
+		nil  bool
+		ok   bool
+	}{
+		{"", false, true},
+		{"average", false, true},
+		{"worst", false, true},
+		{"first", false, true},
+		{"none", true, true},
+		{"best", true, false},
+	}
+	for _, tt := range tests {
+		rule, err := RuleByName(tt.name)
+		if (err == nil) != tt.ok || (rule == nil) != tt.nil {
+			t.Errorf("RuleByName(%q) = nil %v, %v", tt.name, rule == nil, err)
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	chips := compound("chocolate chips", graded(4, -2)...)
+	nested := compound("filling", compound("chocolate chips", graded(4, -2)...), data.Ingredient{Name: "milk", Grade: -3})
+	own := chips
+	own.Grade = 5
+	tests := []struct {
+		name    string
+		rule    Rule
+		in      data.Ingredient
+		grade   int
+		derived bool
+	}{
+		{"average", AverageRule, chips, 1, true},
+		{"worst", WorstRule, chips, -2, true},
+		{"first", FirstRule, chips, 4, true},
+		{"none", nil, chips, ungraded, false},
+		{"nested", AverageRule, nested, -1, true},
+		{"own grade is kept", WorstRule, own, 5, false},
+		{"ungraded child", AverageRule, compound("chips", graded(4, ungraded)...), ungraded, false},
+	}
+	for _, tt := range tests {
+		in := []data.Ingredient{tt.in}
+		got := Fill(in, tt.rule)
+		if got[0].Grade != tt.grade || got[0].Derived != tt.derived {
+			t.Errorf("%s: Fill = %d (derived %v), want %d (derived %v)", tt.name, got[0].Grade, got[0].Derived, tt.grade, tt.derived)
+		}
+		if in[0].Grade != tt.in.Grade {
+			t.Errorf("%s: Fill changed its argument", tt.name)
+		}
+	}
+	if Fill(nil, AverageRule) != nil {
+		t.Error("Fill(nil) is not nil")
+	}
+}
+
+func TestCompounds(t *testing.T) {
+	food := []data.Ingredient{compound("chocolate chips", graded(4, -2)...), {Name: "flour", Grade: 0}}
+	tests := []struct {
+		name     string
+		strategy Strategy
+		score    float64
+		category string
+		fills    bool
+	}{
+		{"average", Compounds{Strategy: Average{}, Rule: AverageRule}, 0.5, "neutral", true},
+		{"worst", Compounds{Strategy: Average{}, Rule: WorstRule}, -1, "neutral", true},
+		{"none", Compounds{Strategy: Average{}}, 0, Missing, false},
+		{"bare strategy", Average{}, 0, Missing, false},
+	}
+	for _, tt := range tests {
+		got := tt.strategy.Grade(food)
+		if !near(got.Score, tt.score) || got.Category != tt.category {
+			t.Errorf("%s: Grade = %v (%s), want %v (%s)", tt.name, got.Score, got.Category, tt.score, tt.category)
+		}
+		if Fills(tt.strategy) != tt.fills {
+			t.Errorf("%s: Fills = %v, want %v", tt.name, !tt.fills, tt.fills)
+		}
+	}
+}
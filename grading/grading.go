@@ -0,0 +1,197 @@
+package grading
+
+/* Package grading turns the grades of a food's ingredients into a grade
+   for the food. How the ingredient grades are combined is up to a Strategy,
+   so different approaches can be compared against the same catalog.
+*/
+
+import (
+	"IngredientGrader/data"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Missing is the category given to a food that has at least one ingredient
+// without a grade
+const Missing = "missing"
+
+// ungraded is the grade a Store reports for an ingredient it does not know
+const ungraded = -10
+
+// Result is the outcome of grading a food
+/*	Score - The numerical grade, between -5 and 5 inclusive. When the food is
+	missing ingredients this is computed from the graded ones only
+	Category - very bad, bad, neutral, good, very good, or missing
+	Weights - The share of Score each ingredient contributed, in the same
+	order as the ingredients that were graded. Ungraded ingredients have a
+	weight of 0; the rest add up to 1
+	Ingredients - The ingredients as they were graded, with any compound
+	grades the strategy filled in
+*/
+type Result struct {
+	Score       float64
+	Category    string
+	Weights     []float64
+	Ingredients []data.Ingredient
+}
+
+// Strategy combines the grades of a food's ingredients, given in label
+// order, into a grade for the food
+type Strategy interface {
+	Name() string
+	Grade(ingredients []data.Ingredient) Result
+}
+
+// Categorize maps a numerical grade onto its categorical grade
+func Categorize(score float64) string {
+	if score < -3 {
+		return "very bad"
+	} else if score < -1 {
+		return "bad"
+	} else if score < 1 {
+		return "neutral"
+	} else if score < 3 {
+		return "good"
+	}
+	return "very good"
+}
+
+// weigh computes the weighted mean of the graded ingredients and builds
+/* a Result from it. raw holds one weight per ingredient; the weights of
+   ungraded ingredients are ignored and the rest are normalized to add up to 1
+*/
+func weigh(ingredients []data.Ingredient, raw []float64) Result {
+	weights := make([]float64, len(ingredients))
+	var total float64
+	for i, in := range ingredients {
+		if in.Grade != ungraded {
+			weights[i] = raw[i]
+			total += raw[i]
+		}
+	}
+	var score float64
+	if total > 0 {
+		for i, in := range ingredients {
+			weights[i] /= total
+			score += weights[i] * float64(in.Grade)
+		}
+	}
+	result := finish(score, ingredients)
+	result.Weights, result.Ingredients = weights, ingredients
+	return result
+}
+
+// finish builds a Result, marking it missing unless every ingredient was graded
+func finish(score float64, ingredients []data.Ingredient) Result {
+	if len(ingredients) == 0 {
+		return Result{Category: Missing}
+	}
+	for _, in := range ingredients {
+		if in.Grade == ungraded {
+			return Result{Score: score, Category: Missing}
+		}
+	}
+	return Result{Score: score, Category: Categorize(score)}
+}
+
+// Config selects and tunes a strategy
+/*	Strategy - The strategy used when no other is asked for: average,
+	weighted or worst. Empty means average
+	Decay - The curve the weighted strategy uses: linear, exponential or
+	harmonic. Empty means linear
+	Rate - How much each position keeps of the previous one's weight under
+	exponential decay, between 0 and 1
+	Penalty - How far the worst strategy moves toward the worst ingredient,
+	between 0 and 1
+	Compound - The rule that grades compound ingredients without a grade of
+	their own from their sub-ingredients: average, worst, first or none.
+	Empty means average
+*/
+type Config struct {
+	Strategy string
+	Decay    string
+	Rate     float64
+	Penalty  float64
+	Compound string
+}
+
+// DefaultConfig is the configuration used for anything not set in the environment
+var DefaultConfig = Config{Strategy: "average", Decay: "linear", Rate: 0.8, Penalty: 0.5, Compound: "average"}
+
+// ConfigFromEnv reads a Config from GRADER_GRADING, GRADER_DECAY,
+// GRADER_DECAY_RATE, GRADER_PENALTY and GRADER_COMPOUND, falling back to
+// DefaultConfig
+func ConfigFromEnv() (Config, error) {
+	c := DefaultConfig
+	if v := os.Getenv("GRADER_GRADING"); v != "" {
+		c.Strategy = v
+	}
+	if v := os.Getenv("GRADER_DECAY"); v != "" {
+		c.Decay = v
+	}
+	if v := os.Getenv("GRADER_COMPOUND"); v != "" {
+		c.Compound = v
+	}
+	for env, field := range map[string]*float64{"GRADER_DECAY_RATE": &c.Rate, "GRADER_PENALTY": &c.Penalty} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return c, fmt.Errorf("grading: %s must be a number between 0 and 1", env)
+		}
+		*field = f
+	}
+	// Build the default strategy once so a bad name or curve fails at start
+	_, err := c.Build("")
+	return c, err
+}
+
+// strategies holds the constructors Build knows about
+var strategies = map[string]func(Config) (Strategy, error){
+	"average": func(Config) (Strategy, error) { return Average{}, nil },
+	"weighted": func(c Config) (Strategy, error) {
+		curve, err := CurveByName(c.Decay, c.Rate)
+		return Weighted{Curve: curve}, err
+	},
+	"worst": func(c Config) (Strategy, error) { return WorstPenalty{Penalty: c.Penalty}, nil },
+}
+
+// Build returns the strategy registered under name, tuned by c and
+/* grading compound ingredients by c.Compound. An empty name selects
+   c.Strategy
+*/
+func (c Config) Build(name string) (Strategy, error) {
+	if name == "" {
+		name = c.Strategy
+	}
+	if name == "" {
+		name = "average"
+	}
+	build, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("grading: unknown strategy %q (have %v)", name, Names())
+	}
+	strategy, err := build(c)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := RuleByName(c.Compound)
+	if err != nil {
+		return nil, err
+	}
+	return Compounds{Strategy: strategy, Rule: rule}, nil
+}
+
+// Names lists the registered strategy names in sorted order
+func Names() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
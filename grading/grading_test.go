@@ -0,0 +1,214 @@
+package grading
+
+import (
+	"IngredientGrader/data"
+	"math"
+	"testing"
+)
+
+// graded returns ingredients with grades, in order, named by position
+func graded(grades ...int) []data.Ingredient {
+	list := make([]data.Ingredient, len(grades))
+	for i, g := range grades {
+		list[i] = data.Ingredient{Name: string(rune('a' + i)), Grade: g}
+	}
+	return list
+}
+
+// near reports whether a and b are equal but for rounding
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestCategorize(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{-5, "very bad"},
+		{-3.01, "very bad"},
+		{-3, "bad"},
+		{-1.01, "bad"},
+		{-1, "neutral"},
+		{0, "neutral"},
+		{0.99, "neutral"},
+		{1, "good"},
+		{2.99, "good"},
+		{3, "very good"},
+		{5, "very good"},
+	}
+	for _, tt := range tests {
+		if got := Categorize(tt.score); got != tt.want {
+			t.Errorf("Categorize(%v) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestAverage(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       []data.Ingredient
+		score    float64
+		category string
+		weights  []float64
+	}{
+		{"empty", nil, 0, Missing, nil},
+		{"one", graded(4), 4, "very good", []float64{1}},
+		{"mean", graded(-4, 0, 1), -1, "neutral", []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		{"ungraded is left out of the score", graded(2, ungraded, 4), 3, Missing, []float64{0.5, 0, 0.5}},
+		{"nothing graded", graded(ungraded, ungraded), 0, Missing, []float64{0, 0}},
+	}
+	for _, tt := range tests {
+		got := Average{}.Grade(tt.in)
+		if !near(got.Score, tt.score) || got.Category != tt.category {
+			t.Errorf("%s: Average = %v (%s), want %v (%s)", tt.name, got.Score, got.Category, tt.score, tt.category)
+		}
+		if len(got.Weights) != len(tt.weights) {
+			t.Errorf("%s: %d weights, want %d", tt.name, len(got.Weights), len(tt.weights))
+			continue
+		}
+		for i := range tt.weights {
+			if !near(got.Weights[i], tt.weights[i]) {
+				t.Errorf("%s: weight %d = %v, want %v", tt.name, i, got.Weights[i], tt.weights[i])
+			}
+		}
+	}
+}
+
+func TestWorstPenalty(t *testing.T) {
+	tests := []struct {
+		name    string
+		penalty float64
+		in      []data.Ingredient
+		score   float64
+	}{
+		{"no penalty is the average", 0, graded(3, 3, -3), 1},
+		{"full penalty is the worst", 1, graded(3, 3, -3), -3},
+		{"half way", 0.5, graded(3, 3, -3), -1},
+		{"all the same", 0.5, graded(2, 2), 2},
+		{"ungraded are ignored", 0.5, graded(4, ungraded, 0), 1},
+	}
+	for _, tt := range tests {
+		got := WorstPenalty{Penalty: tt.penalty}.Grade(tt.in)
+		if !near(got.Score, tt.score) {
+			t.Errorf("%s: WorstPenalty = %v, want %v", tt.name, got.Score, tt.score)
+		}
+		var total float64
+		for _, w := range got.Weights {
+			total += w
+		}
+		if !near(total, 1) {
+			t.Errorf("%s: weights add up to %v", tt.name, total)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		config Config
+		name   string
+		want   string
+		ok     bool
+	}{
+		{DefaultConfig, "", "average", true},
+		{Config{}, "", "average", true},
+		{DefaultConfig, "worst", "worst", true},
+		{Config{Strategy: "weighted", Decay: "harmonic"}, "", "weighted", true},
+		{DefaultConfig, "best", "", false},
+		{Config{Decay: "cubic"}, "weighted", "", false},
+	}
+	for _, tt := range tests {
+		s, err := tt.config.Build(tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("Build(%q) with %+v: error %v, want ok %v", tt.name, tt.config, err, tt.ok)
+			continue
+		}
+		if tt.ok && s.Name() != tt.want {
+			t.Errorf("Build(%q) with %+v = %s, want %s", tt.name, tt.config, s.Name(), tt.want)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("GRADER_GRADING", "worst")
+	t.Setenv("GRADER_PENALTY", "0.25")
+	c, err := ConfigFromEnv()
+	if err != nil || c.Strategy != "worst" || c.Penalty != 0.25 {
+		t.Errorf("ConfigFromEnv = %+v, %v", c, err)
+	}
+	t.Setenv("GRADER_PENALTY", "2")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("ConfigFromEnv accepted a penalty above 1")
+	}
+}
+
+func TestCurves(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve Curve
+		want  []float64
+	}{
+		{"linear", Linear, []float64{4, 3, 2, 1}},
+		{"harmonic", Harmonic, []float64{1, 1.0 / 2, 1.0 / 3, 1.0 / 4}},
+		{"exponential", Exponential(0.5), []float64{1, 0.5, 0.25, 0.125}},
+		{"flat exponential", Exponential(1), []float64{1, 1, 1, 1}},
+	}
+	for _, tt := range tests {
+		for pos, want := range tt.want {
+			if got := tt.curve(pos, len(tt.want)); !near(got, want) {
+				t.Errorf("%s(%d, %d) = %v, want %v", tt.name, pos, len(tt.want), got, want)
+			}
+		}
+	}
+}
+
+func TestCurveByName(t *testing.T) {
+	tests := []struct {
+		name string
+		rate float64
+		ok   bool
+	}{
+		{"", 0.8, true},
+		{"linear", 0, true},
+		{"harmonic", 0, true},
+		{"exponential", 0.8, true},
+		{"exponential", 1, true},
+		{"exponential", 0, false},
+		{"exponential", 1.5, false},
+		{"cubic", 0.8, false},
+	}
+	for _, tt := range tests {
+		_, err := CurveByName(tt.name, tt.rate)
+		if (err == nil) != tt.ok {
+			t.Errorf("CurveByName(%q, %v): error %v, want ok %v", tt.name, tt.rate, err, tt.ok)
+		}
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	tests := []struct {
+		name     string
+		curve    Curve
+		in       []data.Ingredient
+		score    float64
+		category string
+	}{
+		{"nil curve is linear", nil, graded(4, 0, -2), 10.0 / 6, "good"},
+		{"linear", Linear, graded(4, 0, -2), 10.0 / 6, "good"},
+		{"harmonic", Harmonic, graded(4, 0, -2), 20.0 / 11, "good"},
+		{"exponential", Exponential(0.5), graded(4, 0, -2), 2, "good"},
+		{"first counts most", Linear, graded(-4, 4), -4.0 / 3, "bad"},
+		{"ungraded is missing", Linear, graded(4, ungraded, -2), 2.5, Missing},
+	}
+	for _, tt := range tests {
+		got := Weighted{Curve: tt.curve}.Grade(tt.in)
+		if !near(got.Score, tt.score) || got.Category != tt.category {
+			t.Errorf("%s: Weighted = %v (%s), want %v (%s)", tt.name, got.Score, got.Category, tt.score, tt.category)
+		}
+		for i := 1; i < len(got.Weights); i++ {
+			if tt.in[i].Grade != ungraded && tt.in[i-1].Grade != ungraded && got.Weights[i] > got.Weights[i-1] {
+				t.Errorf("%s: weight %d is above weight %d", tt.name, i, i-1)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package grading
+
+import (
+	"IngredientGrader/data"
+	"fmt"
+	"math"
+)
+
+// Average gives every ingredient the same weight. This is how MakeFood has
+// always graded foods
+type Average struct{}
+
+// Name returns "average"
+func (Average) Name() string { return "average" }
+
+// Grade returns the mean grade of the graded ingredients
+func (Average) Grade(ingredients []data.Ingredient) Result {
+	raw := make([]float64, len(ingredients))
+	for i := range raw {
+		raw[i] = 1
+	}
+	return weigh(ingredients, raw)
+}
+
+// Curve gives the raw weight of the ingredient at position (counting from 0)
+// on a label of n ingredients
+type Curve func(position, n int) float64
+
+// Linear weighs position i of n as n-i, so the first ingredient counts n
+// times as much as the last
+func Linear(position, n int) float64 {
+	return float64(n - position)
+}
+
+// Harmonic weighs position i as 1/(i+1): the second ingredient counts half
+// as much as the first, the third a third as much, and so on
+func Harmonic(position, n int) float64 {
+	return 1 / float64(position+1)
+}
+
+// Exponential returns a curve where each position keeps rate of the
+// previous position's weight
+func Exponential(rate float64) Curve {
+	return func(position, n int) float64 {
+		return math.Pow(rate, float64(position))
+	}
+}
+
+// CurveByName returns the decay curve called name. rate is only used by
+// the exponential curve
+func CurveByName(name string, rate float64) (Curve, error) {
+	switch name {
+	case "", "linear":
+		return Linear, nil
+	case "harmonic":
+		return Harmonic, nil
+	case "exponential":
+		if rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("grading: exponential decay needs a rate in (0, 1], got %v", rate)
+		}
+		return Exponential(rate), nil
+	}
+	return nil, fmt.Errorf("grading: unknown decay curve %q", name)
+}
+
+// Weighted gives earlier ingredients more say, since labels list ingredients
+/* by descending weight. Curve decides how quickly the weight falls off with
+   position; a nil Curve is Linear
+*/
+type Weighted struct {
+	Curve Curve
+}
+
+// Name returns "weighted"
+func (Weighted) Name() string { return "weighted" }
+
+// Grade returns the position-weighted mean grade of the graded ingredients
+func (w Weighted) Grade(ingredients []data.Ingredient) Result {
+	curve := w.Curve
+	if curve == nil {
+		curve = Linear
+	}
+	n := len(ingredients)
+	raw := make([]float64, n)
+	for i := range raw {
+		raw[i] = curve(i, n)
+	}
+	return weigh(ingredients, raw)
+}
+
+// WorstPenalty pulls the average toward the worst ingredient, so a single
+/* very bad ingredient cannot be hidden by many neutral ones
+   Penalty - How far toward the worst grade the score moves, from 0 (plain
+   average) to 1 (the worst grade alone)
+*/
+type WorstPenalty struct {
+	Penalty float64
+}
+
+// Name returns "worst"
+func (WorstPenalty) Name() string { return "worst" }
+
+// Grade returns the average moved toward the worst graded ingredient. The
+// worst ingredient's weight is its share of the average plus the penalty
+func (p WorstPenalty) Grade(ingredients []data.Ingredient) Result {
+	avg := Average{}.Grade(ingredients)
+	worst := -1
+	for i, in := range ingredients {
+		if in.Grade == ungraded {
+			continue
+		}
+		if worst < 0 || in.Grade < ingredients[worst].Grade {
+			worst = i
+		}
+	}
+	if worst < 0 || float64(ingredients[worst].Grade) >= avg.Score {
+		return avg
+	}
+
+	raw := make([]float64, len(ingredients))
+	for i, w := range avg.Weights {
+		raw[i] = (1 - p.Penalty) * w
+	}
+	raw[worst] += p.Penalty
+	return weigh(ingredients, raw)
+}
@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"IngredientGrader/auth"
+	"IngredientGrader/data"
+	"IngredientGrader/server"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// HandleRegister is the page handler for the registration page.
+/* A POST checks the username and password, creates a viewer account, signs
+   the new user in and redirects to their account page
+*/
+func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "HandleRegister")
+	if r.Method == "GET" {
+		render(w, "register.html", c)
+		return
+	}
+
+	r.ParseForm()
+	user := strings.Trim(r.Form.Get("user"), " ")
+	pass := r.Form.Get("pass")
+	email := strings.Trim(r.Form.Get("email"), " ")
+
+	for _, problem := range server.CheckUsername(user) {
+		c.AddError(problem)
+	}
+	for _, problem := range server.CheckEmail(email) {
+		c.AddError(problem)
+	}
+	for _, problem := range server.CheckPassword(user, pass) {
+		c.AddError(problem)
+	}
+	if pass != r.Form.Get("confirm") {
+		c.AddError("Passwords do not match")
+	}
+	if c.HasErrors() {
+		render(w, "register.html", c)
+		return
+	}
+
+	if _, err := server.Register(server.Audited(h.store, user), user, pass, email); err != nil {
+		if err == server.ErrDuplicate {
+			c.AddError(fmt.Sprintf("Username %s is already taken", user))
+		} else {
+			log.Println("handler.HandleRegister: ", err)
+			c.AddError("The account could not be created")
+		}
+		render(w, "register.html", c)
+		return
+	}
+
+	if err := h.sessions.Login(w, r, user); err != nil {
+		log.Println("handler.HandleRegister: ", err)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// HandleAccount is the page handler for the signed-in user's account
+/* settings. It shows the account's details, and a POST either changes the
+   email address or, after checking the current password, the password,
+   depending on the action field
+*/
+func (h *Handler) HandleAccount(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "HandleAccount")
+	if r.Method == "POST" {
+		r.ParseForm()
+		if r.Form.Get("action") == "email" {
+			h.changeEmail(c, strings.Trim(r.Form.Get("email"), " "))
+		} else {
+			h.changePassword(r, c, r.Form.Get("current"), r.Form.Get("pass"), r.Form.Get("confirm"))
+		}
+	}
+	if u, ok := h.store.GetUser(c.CurrentUser); ok {
+		c.PageUsers = []data.User{u}
+	}
+	render(w, "account.html", c)
+}
+
+// changePassword checks and saves a new password for the signed-in user,
+// then signs them out everywhere but r's session
+func (h *Handler) changePassword(r *http.Request, c *data.Content, current, next, confirm string) {
+	for _, problem := range server.CheckPasswordChange(h.store, c.CurrentUser, current, next) {
+		c.AddError(problem)
+	}
+	if next != confirm {
+		c.AddError("Passwords do not match")
+	}
+	if c.HasErrors() {
+		return
+	}
+	if err := server.SetPassword(server.Audited(h.store, c.CurrentUser), c.CurrentUser, next); err != nil {
+		log.Println("handler.HandleAccount: ", err)
+		c.AddError("The password could not be changed")
+		return
+	}
+	if err := h.sessions.EndOthers(r, c.CurrentUser); err != nil {
+		log.Println("handler.HandleAccount: ", err)
+	}
+	c.Success = true
+}
+
+// changeEmail checks and saves a new email address for the signed-in user
+func (h *Handler) changeEmail(c *data.Content, email string) {
+	for _, problem := range server.CheckEmail(email) {
+		c.AddError(problem)
+	}
+	if c.HasErrors() {
+		return
+	}
+	if err := server.Audited(h.store, c.CurrentUser).SetEmail(c.CurrentUser, email); err != nil {
+		log.Println("handler.HandleAccount: ", err)
+		c.AddError("The email address could not be changed")
+		return
+	}
+	c.Success = true
+}
+
+// HandleForgot is the page handler for the forgotten password page.
+/* A POST mails a reset link to the account's email address. The page says
+   the same thing whether or not the account exists
+*/
+func (h *Handler) HandleForgot(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "HandleForgot")
+	if r.Method == "POST" {
+		r.ParseForm()
+		user := strings.Trim(r.Form.Get("user"), " ")
+		if user == "" {
+			c.AddError("Username Field cannot be empty")
+		} else {
+			if err := h.resets.Send(user); err != nil {
+				log.Println("handler.HandleForgot: ", err)
+			}
+			c.Success = true
+		}
+	}
+	render(w, "forgot.html", c)
+}
+
+// HandleReset is the page handler for the link in a reset email. The
+/* token query variable must be a live reset token. A POST sets the new
+   password and sends the user to the login page
+*/
+func (h *Handler) HandleReset(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "HandleReset")
+	token := r.URL.Query().Get("token")
+	if _, err := h.resets.Check(token); err != nil {
+		if err != auth.ErrInvalidToken {
+			log.Println("handler.HandleReset: ", err)
+		}
+		c.AddError("This reset link is invalid or has expired")
+		render(w, "reset.html", c)
+		return
+	}
+	// Success lets the template show the form
+	c.Success = true
+	if r.Method == "GET" {
+		render(w, "reset.html", c)
+		return
+	}
+
+	r.ParseForm()
+	pass := r.Form.Get("pass")
+	if pass != r.Form.Get("confirm") {
+		c.AddError("Passwords do not match")
+		render(w, "reset.html", c)
+		return
+	}
+	problems, err := h.resets.Reset(token, pass)
+	for _, problem := range problems {
+		c.AddError(problem)
+	}
+	if err != nil {
+		if err != auth.ErrInvalidToken {
+			log.Println("handler.HandleReset: ", err)
+		}
+		c.AddError("The password could not be reset")
+		c.Success = false
+	}
+	if c.HasErrors() {
+		render(w, "reset.html", c)
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// ManageUsers is the handler for the admin page that lists every account.
+/* A POST changes one account, named by the username field, according to
+   the action field:
+	  - role sets the account's role to the role field
+	  - disable stops the account from signing in
+	  - enable lets a disabled account sign in again
+	  - settings saves the site-wide settings, such as whether admins must
+		use two-factor sign-in. Only admins who use it can require it
+   Admins cannot change their own account here, so they cannot lock
+   themselves out
+*/
+func (h *Handler) ManageUsers(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "ManageUsers")
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		user := r.Form.Get("username")
+		var err error
+		switch action := r.Form.Get("action"); {
+		case action == "settings":
+			err = h.saveSettings(c, r.Form.Get("require_admin_two_factor") != "", strings.Trim(r.Form.Get("auto_match"), " "))
+		case user == c.CurrentUser:
+			c.AddError("You cannot change your own account")
+		case action == "role":
+			role := r.Form.Get("role")
+			if !auth.Role(role).Valid() {
+				c.AddError(fmt.Sprintf("%s is not a role", role))
+			} else {
+				err = h.as(r).SetRole(user, role)
+			}
+		case action == "disable" || action == "enable":
+			err = h.as(r).SetDisabled(user, action == "disable")
+		default:
+			c.AddError("Unknown action")
+		}
+		if err == server.ErrNotFound {
+			c.AddError(fmt.Sprintf("User %s does not exist", user))
+		} else if err != nil {
+			log.Println("handler.ManageUsers: ", err)
+			c.AddError("The account could not be changed")
+		} else if !c.HasErrors() {
+			c.Success = true
+		}
+	}
+
+	users, err := h.store.ListUsers()
+	if err != nil {
+		log.Println("handler.ManageUsers: ", err)
+		c.AddError("The accounts could not be listed")
+	}
+	c.PageUsers = users
+	h.settingsContent(c)
+	render(w, "users.html", c)
+}
+
+// saveSettings saves the site-wide settings from the users page
+func (h *Handler) saveSettings(c *data.Content, requireAdminTwoFactor bool, autoMatch string) error {
+	if requireAdminTwoFactor {
+		if me, _ := h.store.GetUser(c.CurrentUser); !me.TwoFactor {
+			c.AddError("Turn on two-factor sign-in for your own account before requiring it")
+			return nil
+		}
+	}
+	threshold, problems := server.CheckAutoMatch(autoMatch)
+	for _, problem := range problems {
+		c.AddError(problem)
+	}
+	if problems != nil {
+		return nil
+	}
+	return server.Audited(h.store, c.CurrentUser).SetSettings(data.Settings{
+		RequireAdminTwoFactor: requireAdminTwoFactor,
+		AutoMatch:             threshold,
+	})
+}
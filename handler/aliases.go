@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"IngredientGrader/server"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ManageAliases is the admin page listing ingredient aliases. A POST with
+/* the create action makes the alias field another name for the ingredient
+   field, and the delete action removes the alias field. Either way the
+   foods that list the alias are regraded in the background
+*/
+func (h *Handler) ManageAliases(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "ManageAliases")
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		alias := strings.ToLower(strings.Trim(r.Form.Get("alias"), " "))
+		switch r.Form.Get("action") {
+		case "create":
+			canonical := strings.ToLower(strings.Trim(r.Form.Get("ingredient"), " "))
+			for _, problem := range server.CheckAlias(alias, canonical, h.store) {
+				c.AddError(problem)
+			}
+			if !c.HasErrors() {
+				if err := h.as(r).CreateAlias(alias, canonical); err != nil {
+					log.Println("handler.ManageAliases: ", err)
+					c.AddError("The alias could not be saved")
+				}
+			}
+		case "delete":
+			switch err := h.as(r).DeleteAlias(alias); err {
+			case nil:
+			case server.ErrNotFound:
+				c.AddError(fmt.Sprintf("Alias %s does not exist", alias))
+			default:
+				log.Println("handler.ManageAliases: ", err)
+				c.AddError("The alias could not be deleted")
+			}
+		default:
+			c.AddError("Unknown action")
+		}
+		if !c.HasErrors() {
+			c.Success = true
+			h.regrade(r, "handler.ManageAliases", alias)
+		}
+	}
+
+	aliases, err := h.store.ListAliases()
+	if err != nil {
+		log.Println("handler.ManageAliases: ", err)
+		c.AddError("The aliases could not be listed")
+	}
+	c.PageAliases = aliases
+	// The graded ingredients are offered as alias targets
+	if c.PageIngredients, err = h.store.ListIngredients(); err != nil {
+		log.Println("handler.ManageAliases: ", err)
+	}
+	render(w, "aliases.html", c)
+}
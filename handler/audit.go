@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"IngredientGrader/server"
+	"log"
+	"net/http"
+)
+
+// AuditLog is the admin page that lists the audit log, newest first. The
+/* entity, id and actor query parameters narrow it down to one food,
+   ingredient or user, or to what one user did, and before pages back
+   through older entries
+*/
+func (h *Handler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "AuditLog")
+	filter := server.AuditFilterFrom(r.URL.Query())
+	entries, err := h.store.ListAudit(filter)
+	if err != nil {
+		log.Println("handler.AuditLog: ", err)
+		c.AddError("The audit log could not be read")
+	}
+	c.PageAudit, c.AuditFilter = entries, &filter
+	render(w, "audit.html", c)
+}
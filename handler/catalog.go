@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"IngredientGrader/data"
+	"IngredientGrader/server"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ManageFoods is the admin page listing every food, with links to edit
+// and delete each one
+func (h *Handler) ManageFoods(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "ManageFoods")
+	foods, err := h.store.ListFoods()
+	if err != nil {
+		log.Println("handler.ManageFoods: ", err)
+		c.AddError("The foods could not be listed")
+	}
+	c.PageFoods = foods
+	render(w, "foods.html", c)
+}
+
+// EditFood is the admin page for changing the name and ingredients of the
+/* food in the barcode path variable. A POST runs the same checks as
+   MakeFood, then regrades the food and saves it. The barcode itself cannot
+   be changed; delete the food and create it again instead
+*/
+func (h *Handler) EditFood(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "EditFood")
+	barcode := mux.Vars(r)["barcode"]
+	food, ok := h.store.GetFood(barcode)
+	if !ok {
+		h.notFound(w, c, fmt.Sprintf("There is no food associated with barcode: %s", barcode))
+		return
+	}
+	c.PageFood = food
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		food.Name = strings.Trim(r.Form.Get("name"), " ")
+		food.Label = strings.ToLower(r.Form.Get("ingred"))
+		c.PageFood = food
+		for _, problem := range server.CheckFood(barcode, food.Name, food.Label) {
+			c.AddError(problem)
+		}
+		if !c.HasErrors() {
+			food.Ingredients = server.ParseIngredients(food.Label)
+			saved, err := server.EditFood(h.as(r), h.strategy, food)
+			if err != nil {
+				log.Println("handler.EditFood: ", err)
+				c.AddError("The food could not be saved")
+			} else {
+				c.Success = true
+				c.PageFood = saved
+				h.suggest(c, saved)
+			}
+		}
+	}
+	render(w, "editFood.html", c)
+}
+
+// DeleteFood is the admin page that asks for confirmation and then, on a
+// POST, deletes the food in the barcode path variable
+func (h *Handler) DeleteFood(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "DeleteFood")
+	barcode := mux.Vars(r)["barcode"]
+	food, ok := h.store.GetFood(barcode)
+	if !ok {
+		h.notFound(w, c, fmt.Sprintf("There is no food associated with barcode: %s", barcode))
+		return
+	}
+	c.PageFood = food
+
+	if r.Method == "POST" {
+		if err := h.as(r).DeleteFood(barcode); err != nil {
+			log.Println("handler.DeleteFood: ", err)
+			c.AddError("The food could not be deleted")
+		} else {
+			c.Success = true
+		}
+	}
+	render(w, "deleteFood.html", c)
+}
+
+// ManageIngredients is the admin page listing every graded ingredient,
+// with links to edit and delete each one
+func (h *Handler) ManageIngredients(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "ManageIngredients")
+	list, err := h.store.ListIngredients()
+	if err != nil {
+		log.Println("handler.ManageIngredients: ", err)
+		c.AddError("The ingredients could not be listed")
+	}
+	c.PageIngredients = list
+	render(w, "ingredients.html", c)
+}
+
+// EditIngredient is the admin page for renaming or regrading the
+/* ingredient in the name path variable. A POST runs the same checks as
+   MakeIngredient, saves the change, and regrades every food that lists the
+   ingredient in the background. Foods follow a renamed ingredient
+*/
+func (h *Handler) EditIngredient(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "EditIngredient")
+	name := strings.ToLower(mux.Vars(r)["name"])
+	in := h.store.GetIngredient(name)
+	if in.Canonical != "" {
+		// Aliases are changed on the aliases page; send the user to the
+		// ingredient this one stands for
+		http.Redirect(w, r, "/admin/ingredient/"+url.PathEscape(in.Canonical)+"/edit", http.StatusSeeOther)
+		return
+	}
+	if in.Grade == -10 {
+		h.notFound(w, c, fmt.Sprintf("Ingredient %s does not exist", name))
+		return
+	}
+	c.PageIngredients = []data.Ingredient{in}
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		newName := strings.ToLower(strings.Trim(r.Form.Get("name"), " "))
+		g, problems := server.CheckIngredient(newName, strings.Trim(r.Form.Get("grade"), " "))
+		for _, problem := range problems {
+			c.AddError(problem)
+		}
+		if !c.HasErrors() {
+			edited := data.Ingredient{Name: newName, Grade: g}
+			err := h.as(r).UpdateIngredient(name, edited)
+			switch err {
+			case nil:
+				c.Success = true
+				c.PageIngredients = []data.Ingredient{edited}
+				h.regrade(r, "handler.EditIngredient", newName)
+			case server.ErrDuplicate:
+				c.AddError(fmt.Sprintf("Ingredient %s already exists", newName))
+			default:
+				log.Println("handler.EditIngredient: ", err)
+				c.AddError("The ingredient could not be saved")
+			}
+		}
+	}
+	render(w, "editIngredient.html", c)
+}
+
+// DeleteIngredient is the admin page for deleting the ingredient in the
+/* name path variable. It lists the foods that still use the ingredient,
+   which will be left ungraded until it is graded again, and the aliases
+   deleted with it, and deletes it only when the confirmation form is
+   POSTed. Those foods, and the foods that list its aliases, are then
+   regraded in the background
+*/
+func (h *Handler) DeleteIngredient(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "DeleteIngredient")
+	name := strings.ToLower(mux.Vars(r)["name"])
+	in := h.store.GetIngredient(name)
+	if in.Canonical != "" {
+		// Aliases are changed on the aliases page; send the user to the
+		// ingredient this one stands for
+		http.Redirect(w, r, "/admin/ingredient/"+url.PathEscape(in.Canonical)+"/delete", http.StatusSeeOther)
+		return
+	}
+	if in.Grade == -10 {
+		h.notFound(w, c, fmt.Sprintf("Ingredient %s does not exist", name))
+		return
+	}
+	c.PageIngredients = []data.Ingredient{in}
+	foods, err := h.store.FoodsContaining(name)
+	if err != nil {
+		log.Println("handler.DeleteIngredient: ", err)
+	}
+	c.PageFoods = foods
+	aliases, err := server.AliasesOf(h.store, name)
+	if err != nil {
+		log.Println("handler.DeleteIngredient: ", err)
+	}
+	for _, alias := range aliases {
+		c.PageAliases = append(c.PageAliases, data.Alias{Name: alias, Ingredient: name})
+	}
+
+	if r.Method == "POST" {
+		if err := h.as(r).DeleteIngredient(name); err != nil {
+			log.Println("handler.DeleteIngredient: ", err)
+			c.AddError("The ingredient could not be deleted")
+		} else {
+			c.Success = true
+			// The aliases went with it, so foods that list them need a
+			// regrade of their own
+			for _, n := range append([]string{name}, aliases...) {
+				h.regrade(r, "handler.DeleteIngredient", n)
+			}
+		}
+	}
+	render(w, "deleteIngredient.html", c)
+}
+
+// suggest lists the ungraded ingredients of a saved food on the page, with
+// the graded ingredients each may mean
+func (h *Handler) suggest(c *data.Content, food data.Food) {
+	missing, err := server.Suggest(h.store, food)
+	if err != nil {
+		log.Println("handler.suggest: ", err)
+	}
+	c.PageMissing = missing
+}
+
+// regrade queues a regrade of every food that lists the ingredient name,
+// logging under source if it cannot be queued
+func (h *Handler) regrade(r *http.Request, source, name string) {
+	task := server.RegradeContainingTask(h.as(r), h.strategy, name)
+	if _, err := h.queue.Submit("regrade foods containing "+name, task); err != nil {
+		log.Println(source+": ", err)
+	}
+}
+
+// notFound renders a 404 page with message
+func (h *Handler) notFound(w http.ResponseWriter, c *data.Content, message string) {
+	c.AddError(message)
+	w.WriteHeader(http.StatusNotFound)
+	render(w, "forbidden.html", c)
+}
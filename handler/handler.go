@@ -3,49 +3,178 @@ package handler
 /* Package that contains the handler functions for the router */
 
 import (
+	"IngredientGrader/auth"
 	"IngredientGrader/data"
+	"IngredientGrader/grading"
+	"IngredientGrader/jobs"
 	"IngredientGrader/server"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-var db = data.DB
+// Handler holds the dependencies shared by the page handlers. Construct
+/* one with New and register its methods on the router
+ */
+type Handler struct {
+	store    server.Store
+	grades   grading.Config
+	strategy grading.Strategy
+	queue    *jobs.Queue
+	sessions *auth.Manager
+	resets   *server.PasswordResets
+	guard    *auth.Guard
+	tokens   *auth.Tokens
+}
+
+// New returns a Handler that reads and writes the catalog through store
+/* and grades foods with the strategy grades selects. Regrades triggered by
+   the admin pages run on queue, logins are kept in sessions, forgotten
+   passwords are reset through resets, failed sign-ins are slowed down by
+   guard, and users manage their API tokens through tokens
+*/
+func New(store server.Store, grades grading.Config, queue *jobs.Queue, sessions *auth.Manager, resets *server.PasswordResets, guard *auth.Guard, tokens *auth.Tokens) (*Handler, error) {
+	strategy, err := grades.Build("")
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{store: store, grades: grades, strategy: strategy, queue: queue, sessions: sessions, resets: resets, guard: guard, tokens: tokens}, nil
+}
+
+// newContent returns the Content for a page, with the details every page
+// shares, such as the signed-in user and CSRF token, already filled in
+func (h *Handler) newContent(r *http.Request, source string) *data.Content {
+	c := &data.Content{Source: source, CSRFToken: auth.CSRFToken(r)}
+	if u, ok := auth.CurrentUser(r); ok {
+		c.CurrentUser = u.Username
+		c.CurrentRole = string(u.Role)
+	}
+	return c
+}
+
+// as returns the Store for changes made by r, which records them in the
+// audit log under the signed-in user
+func (h *Handler) as(r *http.Request) server.Store {
+	u, _ := auth.CurrentUser(r)
+	return server.Audited(h.store, u.Username)
+}
+
+// render executes the named page template inside the site layout
+func render(w http.ResponseWriter, page string, c *data.Content) {
+	t, err := template.ParseFiles("public/templates/layout.html")
+	if err != nil {
+		log.Println("handler.render: ", err)
+		return
+	}
+	templ, err := template.ParseFiles("public/templates/" + page)
+	if err != nil {
+		log.Println("handler.render: ", err)
+		return
+	}
+	t.AddParseTree("content", templ.Tree)
+	t.ExecuteTemplate(w, "layout", c)
+}
 
 // HandleLogin is the page handler for the login page.
-/* The current iteration is just an empty skeleton. No validation
-   is done nor is are cookies generated
+/* A POST checks the username and password against the stored bcrypt hash
+   and, if they match and the account is not disabled, starts a session and
+   redirects to the landing page. Accounts with two-factor sign-in are sent
+   on to HandleLoginCode instead. Once a username or address has failed too
+   often, attempts are refused without checking the password until the
+   guard's delay or lockout has passed
 */
-func HandleLogin(w http.ResponseWriter, r *http.Request) {
-	t, _ := template.ParseFiles("public/templates/layout.html")
+func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "HandleLogin")
 	if r.Method == "GET" {
-		templ, _ := template.ParseFiles("public/templates/login.html")
-		t.AddParseTree("content", templ.Tree)
-		t.ExecuteTemplate(w, "layout", nil)
+		render(w, "login.html", c)
 		return
 	}
 
 	r.ParseForm()
 	pass := []byte(r.Form.Get("pass"))
-	user := r.Form.Get("user")
+	user := strings.Trim(r.Form.Get("user"), " ")
 
-	dbHash := server.GetHashedPassword(user)
 	if user == "" {
-		fmt.Fprintln(w, "No username")
+		c.AddError("Username Field cannot be empty")
+		render(w, "login.html", c)
 		return
 	}
 
-	
-	if !server.PasswordMatch([]byte(dbHash), pass) {
-		fmt.Fprintln(w, "Password incorrect")
-		return; 
+	ip := auth.ClientIP(r)
+	if wait := h.guard.Wait(user, ip); wait > 0 {
+		c.AddError(tooManyAttempts(wait))
+		w.WriteHeader(http.StatusTooManyRequests)
+		render(w, "login.html", c)
+		return
 	}
-	fmt.Fprintln(w, "Login success!")
+	dbHash := h.store.GetHashedPassword(user)
+	if dbHash == "" || !server.PasswordMatch([]byte(dbHash), pass) {
+		h.guard.Fail(user, ip)
+		c.AddError("Username or password is incorrect")
+		render(w, "login.html", c)
+		return
+	}
+	account, _ := h.store.GetUser(user)
+	if account.Disabled {
+		c.AddError("This account has been disabled")
+		render(w, "login.html", c)
+		return
+	}
+
+	// Accounts with two-factor sign-in still owe a code
+	if account.TwoFactor {
+		if err := h.sessions.LoginPending(w, r, user); err != nil {
+			log.Println("handler.HandleLogin: ", err)
+			c.AddError("Could not sign in, please try again")
+			render(w, "login.html", c)
+			return
+		}
+		// The password was right, but the code still has to be guessed, so
+		// the failures are kept until it is
+		next := url.QueryEscape(r.URL.Query().Get("next"))
+		http.Redirect(w, r, "/login/code?next="+next, http.StatusSeeOther)
+		return
+	}
+
+	if err := h.sessions.Login(w, r, user); err != nil {
+		log.Println("handler.HandleLogin: ", err)
+		c.AddError("Could not sign in, please try again")
+		render(w, "login.html", c)
+		return
+	}
+	h.guard.Succeed(user)
+	server.Audit(h.store, user, server.ActionLogin, server.EntityUser, user, nil, nil)
+	http.Redirect(w, r, safeNext(r.URL.Query().Get("next")), http.StatusSeeOther)
+}
+
+// tooManyAttempts returns the message shown when sign-in must wait
+func tooManyAttempts(wait time.Duration) string {
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return fmt.Sprintf("Too many failed sign-ins. Try again in %s", wait.Round(time.Second))
+}
+
+// safeNext returns next if it is a path on this site, and the landing page
+// otherwise, so the login redirect cannot send users elsewhere
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// HandleLogout ends the current session and returns to the landing page
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	h.sessions.Logout(w, r)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 // HandleFood is the page handler for the Search Food (/food) page
@@ -56,16 +185,17 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 	  - The food does not exist within the database
 	  - The food does exist within the database, but has ingredients
 		with no assigned grades
+   An optional strategy variable regrades the food for display with another
+   grading strategy, so strategies can be compared on the same catalog. The
+   stored grade is left alone
 */
-func HandleFood(w http.ResponseWriter, r *http.Request) {
-	// Load the layout
-	t, _ := template.ParseFiles("public/templates/layout.html")
+func (h *Handler) HandleFood(w http.ResponseWriter, r *http.Request) {
+	// Load the layout, and the list the sub-ingredients are shown with
+	t, _ := template.ParseFiles("public/templates/layout.html", "public/templates/ingredientTree.html")
 	// Now check if values can be parsed from the query string
 	vals, ok := r.URL.Query()["barcode"]
 
-	var content data.Content
-	c := &content
-	c.Source = "HandleFood"
+	c := h.newContent(r, "HandleFood")
 	// If ok is false, or length vals is 0, the page is being loaded
 	if !ok || len(vals) == 0 {
 		templ, _ := template.ParseFiles("public/templates/food.html")
@@ -91,25 +221,40 @@ func HandleFood(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve food from the DB
-	tempFood, exists := server.GetFood(bar)
+	tempFood, exists := h.store.GetFood(bar)
+
+	// Grade again to find each ingredient's weight and the grades of compound
+	// ingredients. If another strategy was asked for, its grade is shown in
+	// place of the stored one
+	strategy, regraded := h.strategy, false
+	if name := r.URL.Query().Get("strategy"); name != "" {
+		other, err := h.grades.Build(name)
+		if err != nil {
+			c.AddError(err.Error())
+		} else {
+			strategy, regraded = other, true
+		}
+	}
+	result := strategy.Grade(tempFood.Ingredients)
+	tempFood.Ingredients = result.Ingredients
+	for i := range tempFood.Ingredients {
+		tempFood.Ingredients[i].Weight = result.Weights[i]
+	}
+	if regraded {
+		tempFood.Grade, tempFood.NumGrade = result.Category, result.Score
+	}
 
 	// Check if it exists, and if food is missing ingredients
 	if !exists {
 		c.AddError(fmt.Sprintf("There is no food associated with barcode: %s", bar))
 	}
-	if tempFood.Grade == "missing" {
+	if tempFood.Grade == grading.Missing {
 		c.AddError(fmt.Sprintf("%s is missing graded ingredients", tempFood.Name))
 	}
 
-	// From here, the barcode is valid
-	list := strings.Split(tempFood.Ingredients, ",")
-	for i := 0; i < len(list); i++ {
-		// Format the str to be usable by server.GetIngredient
-		str := strings.ToLower(list[i])
-		str = strings.Trim(str, " ")
-		// Retreive the ingredient
-		ingredient := server.GetIngredient(str)
-		// Add it to the content struct
+	// From here, the barcode is valid. The store returns the ingredients
+	// already ordered and graded
+	for _, ingredient := range tempFood.Ingredients {
 		c.AddIngredient(ingredient)
 	}
 	c.PageFood = tempFood
@@ -126,12 +271,9 @@ func HandleFood(w http.ResponseWriter, r *http.Request) {
 /* of a Food struct from checked Form data. The data of the Food struct will
    then be added to the database
 */
-func MakeFood(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) MakeFood(w http.ResponseWriter, r *http.Request) {
 	// Create content struct to hold content
-	var content data.Content
-	// Pointer to content struct for method use
-	c := &content
-	c.Source = "MakeFood"
+	c := h.newContent(r, "MakeFood")
 
 	// Load the layout template
 	t, _ := template.ParseFiles("public/templates/layout.html")
@@ -145,68 +287,37 @@ func MakeFood(w http.ResponseWriter, r *http.Request) {
 
 	// If the code has reached here, process form data from the http POST
 	r.ParseForm()
-	barcode := r.Form["barcode"][0]
-	name := r.Form["name"][0]
-	ingred := strings.ToLower(r.Form["ingred"][0])
+	barcode := strings.Trim(r.Form.Get("barcode"), " ")
+	name := strings.Trim(r.Form.Get("name"), " ")
+	ingred := strings.ToLower(r.Form.Get("ingred"))
 
 	// Check if the food searched for exists. Duplicate foods cannot be made
-	_, foodExists := server.GetFood(barcode)
+	_, foodExists := h.store.GetFood(barcode)
 	if foodExists {
 		c.AddError(fmt.Sprintf("Food with barcode: %s already exists", barcode))
 	}
 
 	// Check if any of the form's fields were submitted empty
-	if len(barcode) == 0 {
-		c.AddError("Barcode Field cannot be empty")
+	for _, problem := range server.CheckFood(barcode, name, ingred) {
+		c.AddError(problem)
 	}
-	if len(name) == 0 {
-		c.AddError("Name Field cannot be empty")
-	}
-	if len(ingred) == 0 {
-		c.AddError("Name Field cannot be empty")
-	}
-
-	// Calculate Grade
-	list := strings.Split(ingred, ",")
-	var total int
-	var allFound = true
-
-	for i := 0; i < len(list); i++ {
-		oneIngred := list[i]
-		oneIngred = strings.Trim(oneIngred, " ")
-		oneIngred = strings.ToLower(oneIngred)
 
-		tempIngred := server.GetIngredient(oneIngred)
-		if tempIngred.Grade == -10 {
-			total = 0
-			allFound = false
-			server.RecordMissingIngredient(tempIngred.Name)
+	if !c.HasErrors() {
+		// Parse the statement once; the food stores the ingredients in this order
+		food := data.Food{Barcode: barcode, Name: name, Label: ingred}
+		food.Ingredients = server.ParseIngredients(ingred)
+
+		// Calculate Grade and save
+		food, err := server.AddFood(h.as(r), h.strategy, food)
+		if err != nil {
+			log.Println("handler.MakeFood: ", err)
+			c.AddError("The food could not be saved")
 		} else {
-			total += tempIngred.Grade
-		}
-	}
-	var avgGrade = float64(total) / float64(len(list))
-	var grade = "missing"
-	if allFound {
-		if avgGrade < -3 {
-			grade = "very bad"
-		} else if avgGrade < -1 {
-			grade = "bad"
-		} else if avgGrade < 1 {
-			grade = "neutral"
-		} else if avgGrade < 3 {
-			grade = "good"
-		} else if avgGrade < 5 {
-			grade = "very good"
+			c.Success = true
+			c.PageFood = food
+			h.suggest(c, food)
 		}
 	}
-
-	if !c.HasErrors() {
-		server.CreateFood(barcode, name, ingred, grade, avgGrade)
-		c.Success = true
-		c.PageFood = data.Food{Barcode: barcode, Name: name, Ingredients: ingred, Grade: grade, NumGrade: avgGrade}
-		// create food and display success template
-	}
 	templ, _ := template.ParseFiles("public/templates/makeFood.html")
 	t.AddParseTree("content", templ.Tree)
 	t.ExecuteTemplate(w, "layout", c)
@@ -215,11 +326,9 @@ func MakeFood(w http.ResponseWriter, r *http.Request) {
 // MakeIngredient is the handler for the admin page that allows for the creation
 /* of ingredients and add them to the database
  */
-func MakeIngredient(w http.ResponseWriter, r *http.Request) {
-	// Content struct for holding data, pointer for using methods
-	var content data.Content
-	c := &content
-	c.Source = "MakeIngredient"
+func (h *Handler) MakeIngredient(w http.ResponseWriter, r *http.Request) {
+	// Content struct for holding data
+	c := h.newContent(r, "MakeIngredient")
 
 	t, _ := template.ParseFiles("public/templates/layout.html")
 	if r.Method == "GET" {
@@ -231,79 +340,132 @@ func MakeIngredient(w http.ResponseWriter, r *http.Request) {
 
 	// Parse the frontend for the name and grade entered by the user
 	r.ParseForm()
-	name := r.Form["name"][0]
-	grade := r.Form["grade"][0]
+	name := r.Form.Get("name")
+	grade := r.Form.Get("grade")
 
 	//formatting stuff
 	name = strings.Trim(name, " ")
 	name = strings.ToLower(name)
 	grade = strings.Trim(grade, " ")
 
-	// Check if the name and grade fields are empty
-	if len(name) == 0 {
-		c.AddError("Name Field cannot be empty|")
-	}
-	if len(grade) == 0 {
-		c.AddError("Grade Field cannot be empty|")
-	}
-
-	// Create ingredient struct
-	g, e := strconv.Atoi(grade)
-	if e != nil {
-		c.AddError("Grade could not be parsed. Check to make sure it is a number")
-	}
-
-	// Check if the grade is in range
-	if g < -5 || g > 5 || g%1 != 0 {
-		c.AddError("The grade must be an integer between -5 and 5, inclusive")
+	// Check the name and grade fields
+	g, problems := server.CheckIngredient(name, grade)
+	for _, problem := range problems {
+		c.AddError(problem)
 	}
 
 	// Check if the ingredient already exists
-	in := server.GetIngredient(name)
+	in := h.store.GetIngredient(name)
 
 	if in.Grade != -10 {
 		c.AddError(fmt.Sprintf("Ingredient %s already exists", name))
 	}
 
 	if !c.HasErrors() {
-		server.CreateIngredient(name, g)
-		var temp = data.Ingredient{Name: name, Grade: g}
-		c.AddIngredient(temp)
-		c.Success = true
+		if err := h.as(r).CreateIngredient(name, g); err != nil {
+			log.Println("handler.MakeIngredient: ", err)
+			c.AddError("The ingredient could not be saved")
+		} else {
+			var temp = data.Ingredient{Name: name, Grade: g}
+			c.AddIngredient(temp)
+			c.Success = true
+			// Foods waiting on this ingredient can now be graded
+			h.regrade(r, "handler.MakeIngredient", name)
+		}
 	}
 	templ, _ := template.ParseFiles("public/templates/makeIngredient.html")
 	t.AddParseTree("content", templ.Tree)
 	t.ExecuteTemplate(w, "layout", c)
 }
 
-// HandleAbout is a function that displays the About page
-func HandleAbout(w http.ResponseWriter, r *http.Request) {
-	t, err := template.ParseFiles("public/templates/layout.html")
-	if err != nil {
-		log.Println(err)
+// RegradeFoods is the handler for the admin page that regrades the catalog
+/* in the background. A POST with an empty ingredient field queues a regrade
+   of every food; naming an ingredient regrades only the foods that use it.
+   The page lists recent regrade jobs and their progress
+*/
+func (h *Handler) RegradeFoods(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "RegradeFoods")
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		name := strings.ToLower(strings.Trim(r.Form.Get("ingredient"), " "))
+
+		var err error
+		if len(name) == 0 {
+			_, err = h.queue.Submit("regrade all foods", server.RegradeAllTask(h.as(r), h.strategy))
+		} else {
+			_, err = h.queue.Submit("regrade foods containing "+name, server.RegradeContainingTask(h.as(r), h.strategy, name))
+		}
+		if err != nil {
+			c.AddError(fmt.Sprintf("The regrade could not be started: %s", err))
+		} else {
+			c.Success = true
+		}
+	}
+
+	c.PageJobs = pageJobs(h.queue.Status())
+	render(w, "regrade.html", c)
+}
+
+// pageJobs copies the queue's job snapshots into the jobs printed on the page
+func pageJobs(list []jobs.Status) []data.Job {
+	page := make([]data.Job, len(list))
+	for i, s := range list {
+		page[i] = data.Job{Name: s.Name, State: s.State, Total: s.Total, Done: s.Done, Failed: s.Failed, Error: s.Error}
+	}
+	return page
+}
+
+// Deny answers a page request that failed a role check. Visitors who are
+/* not signed in are sent to the login page, and users whose role is held
+   back until they turn on two-factor sign-in are sent to do so. Other
+   signed-in users whose role is too low get the 403 page
+*/
+func (h *Handler) Deny(w http.ResponseWriter, r *http.Request, status int) {
+	if status == http.StatusUnauthorized {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
 		return
 	}
-	inner, err := template.ParseFiles("public/templates/about.html")
-	if err != nil {
-		log.Println(err)
+	if u, _ := auth.CurrentUser(r); u.Restricted {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
 		return
 	}
-	t.AddParseTree("content", inner.Tree)
-	var content data.Content
-	c := &content
-	c.Source = "HandleAbout"
+	c := h.newContent(r, "Deny")
+	c.AddError("You do not have permission to view this page")
+	w.WriteHeader(http.StatusForbidden)
+	render(w, "forbidden.html", c)
+}
+
+// DenyCSRF answers a form POST whose CSRF token was missing or wrong
+func (h *Handler) DenyCSRF(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "DenyCSRF")
+	c.AddError("This form has expired. Go back, reload the page and try again")
+	w.WriteHeader(http.StatusForbidden)
+	render(w, "forbidden.html", c)
+}
+
+// TooManyRequests answers a page request from a client that has used up
+// its rate limit
+func (h *Handler) TooManyRequests(w http.ResponseWriter, r *http.Request, retry time.Duration) {
+	if retry < time.Second {
+		retry = time.Second
+	}
+	c := h.newContent(r, "TooManyRequests")
+	c.AddError(fmt.Sprintf("Too many requests. Try again in %s", retry.Round(time.Second)))
+	w.WriteHeader(http.StatusTooManyRequests)
+	render(w, "forbidden.html", c)
+}
+
+// HandleAbout is a function that displays the About page
+func (h *Handler) HandleAbout(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "HandleAbout")
 	c.Success = true
-	fmt.Println(t.DefinedTemplates())
-	t.ExecuteTemplate(w, "layout", c)
+	render(w, "about.html", c)
 }
 
 // HandleLanding loads the landing page when the domain is visited */
-func HandleLanding(w http.ResponseWriter, r *http.Request) {
-	t, _ := template.ParseFiles("public/templates/layout.html")
-	templ, _ := template.ParseFiles("public/templates/index2.html")
-	t.AddParseTree("content", templ.Tree)
-
-	t.ExecuteTemplate(w, "layout", nil)
+func (h *Handler) HandleLanding(w http.ResponseWriter, r *http.Request) {
+	render(w, "index2.html", h.newContent(r, "HandleLanding"))
 }
 
 // HandlePublic serves public assets of the website to allow for the
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+)
+
+// lockoutEventLimit is how many audit entries the lockouts page shows
+const lockoutEventLimit = 50
+
+// ManageLockouts is the admin page listing locked out usernames and
+/* addresses along with the lockout audit table. A POST with the unlock
+   action lifts the lockout of the subject field, which is recorded in the
+   audit table under the admin's name
+*/
+func (h *Handler) ManageLockouts(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "ManageLockouts")
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		subject := r.Form.Get("subject")
+		if r.Form.Get("action") != "unlock" || subject == "" {
+			c.AddError("Unknown action")
+		} else if err := h.guard.Unlock(subject, c.CurrentUser); err != nil {
+			log.Println("handler.ManageLockouts: ", err)
+			c.AddError("The lockout could not be lifted")
+		} else {
+			c.Success = true
+		}
+	}
+
+	locked, err := h.guard.Locked()
+	if err != nil {
+		log.Println("handler.ManageLockouts: ", err)
+		c.AddError("The lockouts could not be listed")
+	}
+	events, err := h.guard.Events(lockoutEventLimit)
+	if err != nil {
+		log.Println("handler.ManageLockouts: ", err)
+		c.AddError("The lockout history could not be listed")
+	}
+	c.PageLockouts, c.PageLockoutEvents = locked, events
+	render(w, "lockouts.html", c)
+}
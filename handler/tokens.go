@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"IngredientGrader/auth"
+	"IngredientGrader/server"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// HandleTokens is the page handler for the signed-in user's API tokens.
+/* A POST does one of the following, depending on the action field:
+	  - create makes a token with the name and scope fields and shows it,
+		once, so it can be copied into a script or app
+	  - revoke deletes the token with the id field
+*/
+func (h *Handler) HandleTokens(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "HandleTokens")
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		var err error
+		switch r.Form.Get("action") {
+		case "create":
+			name := strings.Trim(r.Form.Get("name"), " ")
+			scope := r.Form.Get("scope")
+			problems := server.CheckToken(name, scope, auth.Role(c.CurrentRole))
+			for _, problem := range problems {
+				c.AddError(problem)
+			}
+			if problems == nil {
+				c.NewToken, _, err = h.tokens.Issue(c.CurrentUser, name, auth.Role(scope))
+			}
+		case "revoke":
+			if err = h.tokens.Revoke(c.CurrentUser, r.Form.Get("id")); err == auth.ErrNoToken {
+				c.AddError("That token does not exist")
+				err = nil
+			}
+		default:
+			c.AddError("Unknown action")
+		}
+		if err != nil {
+			log.Println("handler.HandleTokens: ", err)
+			c.AddError("The tokens could not be changed")
+		}
+		if !c.HasErrors() {
+			c.Success = true
+		}
+	}
+
+	tokens, err := h.tokens.List(c.CurrentUser)
+	if err != nil {
+		log.Println("handler.HandleTokens: ", err)
+		c.AddError("The tokens could not be listed")
+	}
+	c.PageTokens = tokens
+	render(w, "tokens.html", c)
+}
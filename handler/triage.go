@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"IngredientGrader/data"
+	"IngredientGrader/server"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Triage is the grader page listing the ingredients foods are waiting on,
+/* most recorded first, with the foods each one blocks. A POST acts on the
+   name field: the grade action creates it with the grade field, alias makes
+   it an alias of the ingredient field, and dismiss drops it from the list.
+   Grading or aliasing regrades the blocked foods in the background
+*/
+func (h *Handler) Triage(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "Triage")
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		name := strings.ToLower(strings.Trim(r.Form.Get("name"), " "))
+		switch r.Form.Get("action") {
+		case "grade":
+			h.triageGrade(r, c, name, strings.Trim(r.Form.Get("grade"), " "))
+		case "alias":
+			h.triageAlias(r, c, name, strings.ToLower(strings.Trim(r.Form.Get("ingredient"), " ")))
+		case "dismiss":
+			if err := server.DismissMissing(h.store, c.CurrentUser, name); err != nil {
+				log.Println("handler.Triage: ", err)
+				c.AddError("The ingredient could not be dismissed")
+			} else {
+				c.Success = true
+			}
+		default:
+			c.AddError("Unknown action")
+		}
+	}
+
+	missing, err := server.Triage(h.store)
+	if err != nil {
+		log.Println("handler.Triage: ", err)
+		c.AddError("The missing ingredients could not be listed")
+	}
+	c.PageMissing = missing
+	// The graded ingredients are offered as alias targets
+	if c.PageIngredients, err = h.store.ListIngredients(); err != nil {
+		log.Println("handler.Triage: ", err)
+	}
+	render(w, "triage.html", c)
+}
+
+// triageGrade grades the missing ingredient name for the Triage page
+func (h *Handler) triageGrade(r *http.Request, c *data.Content, name, grade string) {
+	g, problems := server.CheckIngredient(name, grade)
+	for _, problem := range problems {
+		c.AddError(problem)
+	}
+	if c.HasErrors() {
+		return
+	}
+	switch err := server.GradeMissing(h.as(r), name, g); err {
+	case nil:
+		c.Success = true
+		h.regrade(r, "handler.Triage", name)
+	case server.ErrDuplicate:
+		c.AddError(fmt.Sprintf("Ingredient %s already exists", name))
+	default:
+		log.Println("handler.Triage: ", err)
+		c.AddError("The ingredient could not be saved")
+	}
+}
+
+// triageAlias makes the missing ingredient name an alias of canonical for
+// the Triage page
+func (h *Handler) triageAlias(r *http.Request, c *data.Content, name, canonical string) {
+	for _, problem := range server.CheckAlias(name, canonical, h.store) {
+		c.AddError(problem)
+	}
+	if c.HasErrors() {
+		return
+	}
+	if err := server.AliasMissing(h.as(r), name, canonical); err != nil {
+		log.Println("handler.Triage: ", err)
+		c.AddError("The alias could not be saved")
+		return
+	}
+	c.Success = true
+	h.regrade(r, "handler.Triage", name)
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"IngredientGrader/auth"
+	"IngredientGrader/data"
+	"IngredientGrader/server"
+	"log"
+	"net/http"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// HandleLoginCode is the page handler for the second step of signing in
+/* to an account with two-factor sign-in. It needs the pending session
+   HandleLogin started; a POST checks the code, which can also be a
+   recovery code, and finishes signing in. Wrong codes count as failed
+   sign-ins, like wrong passwords
+*/
+func (h *Handler) HandleLoginCode(w http.ResponseWriter, r *http.Request) {
+	pending, ok := h.sessions.Pending(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	c := h.newContent(r, "HandleLoginCode")
+	if r.Method == "GET" {
+		render(w, "loginCode.html", c)
+		return
+	}
+
+	r.ParseForm()
+	code := strings.Trim(r.Form.Get("code"), " ")
+	if code == "" {
+		c.AddError("Code Field cannot be empty")
+		render(w, "loginCode.html", c)
+		return
+	}
+	ip := auth.ClientIP(r)
+	if wait := h.guard.Wait(pending.Username, ip); wait > 0 {
+		c.AddError(tooManyAttempts(wait))
+		w.WriteHeader(http.StatusTooManyRequests)
+		render(w, "loginCode.html", c)
+		return
+	}
+	ok, err := server.CheckSecondFactor(h.store, pending.Username, code)
+	if err != nil {
+		log.Println("handler.HandleLoginCode: ", err)
+	}
+	if !ok {
+		h.guard.Fail(pending.Username, ip)
+		c.AddError("The code is incorrect")
+		render(w, "loginCode.html", c)
+		return
+	}
+
+	if err := h.sessions.Login(w, r, pending.Username); err != nil {
+		log.Println("handler.HandleLoginCode: ", err)
+		c.AddError("Could not sign in, please try again")
+		render(w, "loginCode.html", c)
+		return
+	}
+	h.guard.Succeed(pending.Username)
+	server.Audit(h.store, pending.Username, server.ActionLogin, server.EntityUser, pending.Username, nil, nil)
+	http.Redirect(w, r, safeNext(r.URL.Query().Get("next")), http.StatusSeeOther)
+}
+
+// HandleTwoFactor is the page handler for setting up two-factor sign-in.
+/* Visiting the page starts enrollment, showing a QR code for the user's
+   authenticator app. A POST does one of the following, depending on the
+   action field:
+	  - enable checks a code from the app and turns two-factor sign-in on,
+		showing the new recovery codes
+	  - recovery checks a code and replaces the recovery codes
+	  - disable checks the account password and turns two-factor sign-in
+		off, unless the account's role requires it
+*/
+func (h *Handler) HandleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	c := h.newContent(r, "HandleTwoFactor")
+	user, _ := h.store.GetUser(c.CurrentUser)
+	required := server.RequiresTwoFactor(h.store, user.Role)
+
+	var codes []string
+	if r.Method == "POST" {
+		r.ParseForm()
+		code := strings.Trim(r.Form.Get("code"), " ")
+		var (
+			problems []string
+			err      error
+		)
+		switch r.Form.Get("action") {
+		case "enable":
+			codes, problems, err = server.EnableTwoFactor(h.store, c.CurrentUser, code)
+		case "recovery":
+			var ok bool
+			if ok, err = server.CheckSecondFactor(h.store, c.CurrentUser, code); ok {
+				codes, err = server.NewRecoveryCodes(h.store, c.CurrentUser)
+			} else if err == nil {
+				problems = []string{"The code is incorrect"}
+			}
+		case "disable":
+			hash := h.store.GetHashedPassword(c.CurrentUser)
+			if required {
+				problems = []string{"Two-factor sign-in is required for your role"}
+			} else if !server.PasswordMatch([]byte(hash), []byte(r.Form.Get("pass"))) {
+				problems = []string{"Password is incorrect"}
+			} else {
+				err = server.DisableTwoFactor(h.store, c.CurrentUser)
+			}
+		default:
+			problems = []string{"Unknown action"}
+		}
+		for _, problem := range problems {
+			c.AddError(problem)
+		}
+		if err != nil {
+			log.Println("handler.HandleTwoFactor: ", err)
+			c.AddError("Two-factor sign-in could not be changed")
+		}
+		if !c.HasErrors() {
+			c.Success = true
+		}
+	}
+
+	if _, err := server.StartTwoFactor(h.store, c.CurrentUser); err != nil && err != server.ErrTwoFactorEnabled {
+		log.Println("handler.HandleTwoFactor: ", err)
+	}
+	status, err := server.TwoFactorStatus(h.store, c.CurrentUser, required)
+	if err != nil {
+		log.Println("handler.HandleTwoFactor: ", err)
+	}
+	status.RecoveryCodes = codes
+	c.PageTwoFactor = &status
+	render(w, "twoFactor.html", c)
+}
+
+// TwoFactorQR serves the QR code of the signed-in user's provisioning URI
+/* as a PNG, rendered on the server so the secret never leaves the site.
+   There is nothing to serve once enrollment has finished
+*/
+func (h *Handler) TwoFactorQR(w http.ResponseWriter, r *http.Request) {
+	u, _ := auth.CurrentUser(r)
+	status, err := server.TwoFactorStatus(h.store, u.Username, false)
+	if err != nil || status.URI == "" {
+		http.NotFound(w, r)
+		return
+	}
+	png, err := qrcode.Encode(status.URI, qrcode.Medium, 256)
+	if err != nil {
+		log.Println("handler.TwoFactorQR: ", err)
+		http.Error(w, "The QR code could not be made", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// settingsContent loads the site-wide settings into c for the admin pages
+func (h *Handler) settingsContent(c *data.Content) {
+	settings, err := h.store.GetSettings()
+	if err != nil {
+		log.Println("handler.settingsContent: ", err)
+	}
+	c.Settings = &settings
+}
@@ -0,0 +1,252 @@
+package jobs
+
+/* Package jobs runs long pieces of work, such as regrading the catalog,
+   on a pool of background workers so HTTP handlers can return straight
+   away. Every job reports its progress, and all of them are cancelled
+   when the queue shuts down.
+*/
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by Submit once Shutdown has been called
+var ErrClosed = errors.New("jobs: queue is shut down")
+
+// ErrFull is returned by Submit when too many jobs are already waiting
+var ErrFull = errors.New("jobs: queue is full")
+
+// States a job moves through. A job is Queued until a worker picks it up,
+// Running while its task runs, then Finished, Failed or Cancelled
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Finished  = "finished"
+	Failed    = "failed"
+	Cancelled = "cancelled"
+)
+
+// history is how many jobs Status remembers, newest first
+const history = 50
+
+// Task is the work a job does. It should stop and return ctx.Err() once
+// ctx is cancelled, and report how far it has got through p
+type Task func(ctx context.Context, p *Progress) error
+
+// Progress counts the items a task has to process. It is safe for
+// concurrent use and a nil *Progress ignores every call
+type Progress struct {
+	total, done, failed int64
+}
+
+// SetTotal records how many items the task will process
+func (p *Progress) SetTotal(n int) {
+	if p != nil {
+		atomic.StoreInt64(&p.total, int64(n))
+	}
+}
+
+// Done records that one item was processed successfully
+func (p *Progress) Done() {
+	if p != nil {
+		atomic.AddInt64(&p.done, 1)
+	}
+}
+
+// Fail records that one item could not be processed
+func (p *Progress) Fail() {
+	if p != nil {
+		atomic.AddInt64(&p.failed, 1)
+	}
+}
+
+// Status is a snapshot of a job, for printing to a page or encoding as JSON
+type Status struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Total    int       `json:"total"`
+	Done     int       `json:"done"`
+	Failed   int       `json:"failed"`
+	Error    string    `json:"error,omitempty"`
+	Created  time.Time `json:"created"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+// job is a task submitted to a Queue along with its bookkeeping
+type job struct {
+	task     Task
+	progress Progress
+
+	mu     sync.Mutex
+	status Status
+}
+
+// snapshot returns the job's current Status
+func (j *job) snapshot() Status {
+	j.mu.Lock()
+	s := j.status
+	j.mu.Unlock()
+	s.Total = int(atomic.LoadInt64(&j.progress.total))
+	s.Done = int(atomic.LoadInt64(&j.progress.done))
+	s.Failed = int(atomic.LoadInt64(&j.progress.failed))
+	return s
+}
+
+// setState moves the job to state, recording err if there is one
+func (j *job) setState(state string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.State = state
+	switch state {
+	case Running:
+		j.status.Started = time.Now()
+	case Finished, Failed, Cancelled:
+		j.status.Finished = time.Now()
+	}
+	if err != nil {
+		j.status.Error = err.Error()
+	}
+}
+
+// Queue hands submitted jobs to a fixed pool of workers
+type Queue struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending chan *job
+	wg      sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+	nextID int
+	jobs   []*job
+}
+
+// NewQueue starts workers goroutines that run jobs in the order they are
+/* submitted. At most size jobs can wait for a free worker
+ */
+func NewQueue(workers, size int) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{ctx: ctx, cancel: cancel, pending: make(chan *job, size)}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// work runs jobs until the queue shuts down
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case j := <-q.pending:
+			q.run(j)
+		}
+	}
+}
+
+// run executes a single job and records how it ended
+func (q *Queue) run(j *job) {
+	if q.ctx.Err() != nil {
+		j.setState(Cancelled, nil)
+		return
+	}
+	j.setState(Running, nil)
+	err := j.task(q.ctx, &j.progress)
+	switch {
+	case err == nil:
+		j.setState(Finished, nil)
+	case q.ctx.Err() != nil:
+		j.setState(Cancelled, err)
+	default:
+		j.setState(Failed, err)
+	}
+}
+
+// Submit queues task under a descriptive name and returns the job's
+// initial Status
+func (q *Queue) Submit(name string, task Task) (Status, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Status{}, ErrClosed
+	}
+
+	q.nextID++
+	j := &job{task: task, status: Status{ID: q.nextID, Name: name, State: Queued, Created: time.Now()}}
+	select {
+	case q.pending <- j:
+	default:
+		q.nextID--
+		return Status{}, ErrFull
+	}
+
+	q.jobs = append(q.jobs, j)
+	if len(q.jobs) > history {
+		q.jobs = q.jobs[len(q.jobs)-history:]
+	}
+	return j.snapshot(), nil
+}
+
+// Status returns a snapshot of the most recent jobs, newest first
+func (q *Queue) Status() []Status {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]Status, 0, len(q.jobs))
+	for i := len(q.jobs) - 1; i >= 0; i-- {
+		list = append(list, q.jobs[i].snapshot())
+	}
+	return list
+}
+
+// Get returns a snapshot of the job with a matching id, if it is still
+// remembered
+func (q *Queue) Get(id int) (Status, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		if j.status.ID == id {
+			return j.snapshot(), true
+		}
+	}
+	return Status{}, false
+}
+
+// Shutdown stops accepting jobs, cancels the running ones and waits for
+/* the workers to exit or ctx to expire. Jobs still waiting for a worker
+   are marked cancelled without being run
+*/
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for {
+		select {
+		case j := <-q.pending:
+			j.setState(Cancelled, nil)
+		default:
+			return nil
+		}
+	}
+}
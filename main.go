@@ -1,38 +1,290 @@
 package main
 
 import (
+	"IngredientGrader/api"
+	"IngredientGrader/auth"
 	"IngredientGrader/data"
+	"IngredientGrader/grading"
+	"IngredientGrader/handler"
+	"IngredientGrader/jobs"
+	"IngredientGrader/mail"
+	"IngredientGrader/ratelimit"
 	"IngredientGrader/routes"
 	"IngredientGrader/server"
+	"context"
+	"crypto/rand"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
-	routes.InitRoutes()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		if err := runRole(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	store, err := openStore()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	grades, err := grading.ConfigFromEnv()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	// Regrades run in the background so admin pages return straight away
+	queue := jobs.NewQueue(2, 100)
+	sessions := openSessions(store)
+	resets, err := openResets(store, sessions)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	guard, err := openGuard()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tokens := openTokens(sessions)
+	h, err := handler.New(store, grades, queue, sessions, resets, guard, tokens)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	strategy, err := grades.Build("")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	csrf, err := openCSRF(sessions)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	limits, err := openLimits()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	routes.InitRoutes(h, api.New(store, strategy, queue, sessions, resets, guard, tokens), sessions, tokens, csrf, limits)
 	router := routes.Router
 
+	// Serve the website until interrupted
+	srv := &http.Server{Addr: ":8000", Handler: router}
+	go func() {
+		if ServeErr := srv.ListenAndServe(); ServeErr != http.ErrServerClosed {
+			log.Fatalln(ServeErr)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	// Give requests and running jobs a few seconds to wrap up
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("shutdown: ", err)
+	}
+	if err := queue.Shutdown(ctx); err != nil {
+		log.Println("shutdown: ", err)
+	}
+}
+
+// openStore picks the Store named by GRADER_DB. "memory" keeps everything
+/* in process and needs no database; anything else is handed to data.Init.
+   A SQLite database is migrated on start so a fresh file is usable
+   straight away; MySQL is left to the migrate subcommand
+*/
+func openStore() (server.Store, error) {
+	if os.Getenv("GRADER_DB") == "memory" {
+		return server.NewMemoryStore(), nil
+	}
+
 	// Connect to the database
-	if dbError := data.Init(); dbError != nil {
-		log.Fatalln(dbError)
+	if err := data.Init(); err != nil {
+		return nil, err
+	}
+	if data.Driver == "sqlite3" {
+		if _, err := data.MigrateUp(); err != nil {
+			return nil, err
+		}
+		return server.NewSQLiteStore(data.DB), nil
+	}
+	return server.NewMySQLStore(data.DB), nil
+}
+
+// openSessions keeps sessions in the database when there is one, so they
+/* survive restarts and are shared between instances. GRADER_SESSIONS=memory
+   keeps them in process instead. GRADER_INSECURE_COOKIES=1 lets the session
+   cookie be sent over plain HTTP for local development
+*/
+func openSessions(users server.Store) *auth.Manager {
+	var store auth.SessionStore
+	if data.DB == nil || os.Getenv("GRADER_SESSIONS") == "memory" {
+		store = auth.NewMemorySessions()
+	} else {
+		store = auth.NewSQLSessions(data.DB)
+	}
+	m := auth.NewManager(store, users)
+	m.Secure = os.Getenv("GRADER_INSECURE_COOKIES") == ""
+	m.RequireTwoFactor = func(role auth.Role) bool {
+		return server.RequiresTwoFactor(users, string(role))
+	}
+	return m
+}
+
+// openTokens keeps API tokens in the database when there is one, so they
+// keep working across restarts and instances
+func openTokens(sessions *auth.Manager) *auth.Tokens {
+	if data.DB == nil {
+		return auth.NewTokens(auth.NewMemoryTokens(), sessions)
+	}
+	return auth.NewTokens(auth.NewSQLTokens(data.DB), sessions)
+}
+
+// openResets builds the forgotten password flow from the environment
+/*	GRADER_RESET_SECRET - The key reset tokens are signed with. If it is not
+	set a random key is used, and reset links stop working on restart
+	GRADER_BASE_URL - The address reset links point at
+	See mail.FromEnv for how reset emails are sent
+*/
+func openResets(store server.Store, sessions *auth.Manager) (*server.PasswordResets, error) {
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := secretFromEnv("GRADER_RESET_SECRET", "reset links")
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens auth.ResetStore
+	if data.DB == nil {
+		tokens = auth.NewMemoryResets()
+	} else {
+		tokens = auth.NewSQLResets(data.DB)
+	}
+
+	baseURL := os.Getenv("GRADER_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8000"
+	}
+	return server.NewPasswordResets(store, auth.NewResets(tokens, secret), mailer, sessions, strings.TrimSuffix(baseURL, "/")), nil
+}
+
+// openGuard builds the protection against guessing passwords. Failed
+/* sign-ins are counted in the database when there is one, so every
+   instance sees the same counts
+	GRADER_LOCKOUT_AFTER - How many failed sign-ins in a row lock a username
+	out. Defaults to 10
+	GRADER_LOCKOUT_DURATION - How long a lockout lasts, such as 30m.
+	Defaults to 15m
+	GRADER_TRUST_PROXY=1 - Count failures by the address in
+	X-Forwarded-For rather than the connection's, for when the server sits
+	behind a proxy
+*/
+func openGuard() (*auth.Guard, error) {
+	var store auth.FailureStore
+	if data.DB == nil {
+		store = auth.NewMemoryFailures()
+	} else {
+		store = auth.NewSQLFailures(data.DB)
+	}
+	g := auth.NewGuard(store)
+
+	if after := os.Getenv("GRADER_LOCKOUT_AFTER"); after != "" {
+		n, err := strconv.Atoi(after)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("GRADER_LOCKOUT_AFTER must be a positive number, not %q", after)
+		}
+		g.LockAfter = n
+	}
+	if duration := os.Getenv("GRADER_LOCKOUT_DURATION"); duration != "" {
+		d, err := time.ParseDuration(duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("GRADER_LOCKOUT_DURATION must be a duration such as 15m, not %q", duration)
+		}
+		g.LockFor = d
+	}
+	auth.TrustProxy = os.Getenv("GRADER_TRUST_PROXY") != ""
+	return g, nil
+}
+
+// openLimits builds the request rate limits from the environment. Each is
+/* written as count/unit[,burst], such as 60/m,30, or off for no limit
+	GRADER_RATE_LOOKUP - Food lookups at /food. Defaults to 60/m,30
+	GRADER_RATE_API - API requests. Defaults to 300/m,60
+	GRADER_RATE_LOGIN - Sign in, registration and password reset attempts.
+	Defaults to 10/m
+*/
+func openLimits() (routes.Limits, error) {
+	var limits routes.Limits
+	for _, l := range []struct {
+		name, fallback string
+		limiter        **ratelimit.Limiter
+	}{
+		{"GRADER_RATE_LOOKUP", "60/m,30", &limits.Lookup},
+		{"GRADER_RATE_API", "300/m,60", &limits.API},
+		{"GRADER_RATE_LOGIN", "10/m", &limits.Login},
+	} {
+		value := os.Getenv(l.name)
+		if value == "" {
+			value = l.fallback
+		}
+		if value == "off" {
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return limits, fmt.Errorf("%s: %v", l.name, err)
+		}
+		*l.limiter = ratelimit.New(limit)
 	}
+	return limits, nil
+}
 
-	server.Init()
+// openCSRF builds the CSRF protection for sessions. GRADER_CSRF_SECRET is
+/* the key tokens are signed with. If it is not set a random key is used,
+   and forms that were open when the server restarted must be reloaded
+*/
+func openCSRF(sessions *auth.Manager) (*auth.CSRF, error) {
+	secret, err := secretFromEnv("GRADER_CSRF_SECRET", "open forms")
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewCSRF(sessions, secret), nil
+}
 
-	// Serve the website
-	if ServeErr := http.ListenAndServe(":8000", router); ServeErr != nil {
-		log.Fatalln(ServeErr)
+// secretFromEnv returns the key in the environment variable name, or a
+/* random key if it is not set. what names the things signed with the key,
+   which stop working when the server restarts if the key is random
+*/
+func secretFromEnv(name, what string) ([]byte, error) {
+	if secret := os.Getenv(name); secret != "" {
+		return []byte(secret), nil
+	}
+	log.Printf("%s is not set; %s will stop working when the server restarts", name, what)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
 	}
+	return secret, nil
 }
 
 /* To Do
-Add restrictions that limit who can use admin pages and api
 SQL Injection protection
-Implement api for public consumption
-Periodically extract all foods with grade 'missing' to recalculate grade, OR do so every time an
-	ingredient is added to the database
 When printing to a table for /food, make the header printing better
-Admin functionality to alter database without needing to check DB itself
 
 Double Check
 	Whether router can be constructed in InitRoutes and returned
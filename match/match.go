@@ -0,0 +1,233 @@
+package match
+
+/* Package match finds the known ingredient names an unknown one most likely
+   means. Names are normalized first, so case, punctuation, spacing, accents
+   and plurals do not matter, and then compared both by edit distance, which
+   catches typos, and by trigram similarity, which catches reordered or
+   extra words. Scores run from 0, nothing alike, to 1, the same name once
+   normalized.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Suggestion is a known ingredient an unknown name may mean
+/*	Name - The ingredient's name. If an alias matched, this is the
+	ingredient it stands for
+	Score - How alike the names are, from 0 to 1
+*/
+type Suggestion struct {
+	Name  string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+// Percent formats Score as a percentage for the pages
+func (s Suggestion) Percent() string {
+	return fmt.Sprintf("%.0f%%", s.Score*100)
+}
+
+// folds maps accented Latin letters to the letter without the accent
+var folds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a",
+	'æ': "ae", 'ç': "c", 'č': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i",
+	'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o",
+	'œ': "oe", 'ß': "ss", 'š': "s",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u",
+	'ý': "y", 'ÿ': "y", 'ž': "z",
+}
+
+// Normalize reduces name to the form names are compared in: lowercase,
+/* without accents, with punctuation turned into spaces, runs of spaces
+   collapsed, and each word made singular
+*/
+func Normalize(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case folds[r] != "":
+			b.WriteString(folds[r])
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(b.String())
+	for i, w := range words {
+		words[i] = singular(w)
+	}
+	return strings.Join(words, " ")
+}
+
+// singular returns the singular of an English plural, or word unchanged if
+// it does not look like one. Short words are left alone
+func singular(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "oes"),
+		strings.HasSuffix(word, "ses"),
+		strings.HasSuffix(word, "xes"),
+		strings.HasSuffix(word, "zes"),
+		strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// editSimilarity is one less the Levenshtein distance between a and b as
+// a share of the longer name
+func editSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// trigrams counts the three letter runs of s, padded so the first and last
+// letters count as much as the rest
+func trigrams(s string) map[string]int {
+	r := []rune("  " + s + " ")
+	grams := make(map[string]int)
+	for i := 0; i+3 <= len(r); i++ {
+		grams[string(r[i:i+3])]++
+	}
+	return grams
+}
+
+// trigramSimilarity is the Dice coefficient of two sets of trigrams
+func trigramSimilarity(a, b map[string]int) float64 {
+	total, shared := 0, 0
+	for g, n := range a {
+		total += n
+		if m := b[g]; m < n {
+			shared += m
+		} else {
+			shared += n
+		}
+	}
+	for _, n := range b {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+// entry is a known name as the Matcher compares it
+type entry struct {
+	target string
+	norm   string
+	grams  map[string]int
+}
+
+// score returns how alike the normalized name with grams is to e, the
+// better of their edit distance and trigram similarities
+func (e entry) score(norm string, grams map[string]int) float64 {
+	if e.norm == norm {
+		return 1
+	}
+	edit, tri := editSimilarity(norm, e.norm), trigramSimilarity(grams, e.grams)
+	if tri > edit {
+		return tri
+	}
+	return edit
+}
+
+// Matcher suggests known ingredients for unknown names. Build one with New
+// and Add, then call Suggest; it is safe for concurrent Suggest calls
+type Matcher struct {
+	entries []entry
+}
+
+// New returns a Matcher that knows names, each suggested as itself
+func New(names ...string) *Matcher {
+	m := &Matcher{}
+	for _, name := range names {
+		m.Add(name, name)
+	}
+	return m
+}
+
+// Add teaches m the known name, which is suggested as target. Aliases are
+// added with the ingredient they stand for as target
+func (m *Matcher) Add(name, target string) {
+	norm := Normalize(name)
+	m.entries = append(m.entries, entry{target: target, norm: norm, grams: trigrams(norm)})
+}
+
+// Suggest returns up to limit known ingredients name may mean that score
+/* at least min, best first. Each ingredient is suggested once, with the
+   score of whichever of its names matched best
+*/
+func (m *Matcher) Suggest(name string, limit int, min float64) []Suggestion {
+	norm := Normalize(name)
+	grams := trigrams(norm)
+	best := make(map[string]float64)
+	for _, e := range m.entries {
+		score := e.score(norm, grams)
+		if score >= min && score > best[e.target] {
+			best[e.target] = score
+		}
+	}
+
+	list := make([]Suggestion, 0, len(best))
+	for target, score := range best {
+		list = append(list, Suggestion{Name: target, Score: score})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].Name < list[j].Name
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
@@ -0,0 +1,133 @@
+package match
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Sugar", "sugar"},
+		{"  cane   SUGAR ", "cane sugar"},
+		{"crème fraîche", "creme fraiche"},
+		{"jalapeño", "jalapeno"},
+		{"mono- and di-glycerides", "mono and di glyceride"},
+		{"vitamin b12", "vitamin b12"},
+		{"oats", "oat"},
+		{"berries", "berry"},
+		{"tomatoes", "tomato"},
+		{"glasses", "glass"},
+		{"boxes", "box"},
+		{"peaches", "peach"},
+		{"radishes", "radish"},
+		{"grass", "grass"},
+		{"asparagus", "asparagus"},
+		{"anise", "anise"},
+		{"hummus", "hummus"},
+		{"peas", "pea"},
+		{"gas", "gas"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEditSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"salt", "salt", 1},
+		{"salt", "", 0},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"cocoa buter", "cocoa butter", 1 - 1.0/12},
+		{"abc", "xyz", 0},
+	}
+	for _, tt := range tests {
+		if got := editSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("editSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := editSimilarity(tt.b, tt.a); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("editSimilarity(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestTrigramSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"salt", "salt", 1, 1},
+		{"", "salt", 0, 0},
+		{"salt", "pepper", 0, 0},
+		{"sea salt", "salt sea", 0.6, 0.9},
+		{"wheat flour", "flour", 0.5, 0.8},
+	}
+	for _, tt := range tests {
+		got := trigramSimilarity(trigrams(tt.a), trigrams(tt.b))
+		if got < tt.min || got > tt.max {
+			t.Errorf("trigramSimilarity(%q, %q) = %v, want between %v and %v", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	m := New("sugar", "oats", "cocoa butter", "salt", "sea salt")
+	m.Add("sucrose", "sugar")
+	tests := []struct {
+		name  string
+		limit int
+		min   float64
+		want  []string
+	}{
+		{"Oat", 3, 0.6, []string{"oats"}},
+		{"sugars", 3, 0.6, []string{"sugar"}},
+		{"SUCROSE", 3, 0.6, []string{"sugar"}},
+		{"cocoa buter", 3, 0.6, []string{"cocoa butter"}},
+		{"salt", 3, 0.6, []string{"salt", "sea salt"}},
+		{"salt", 1, 0.6, []string{"salt"}},
+		{"xanthan gum", 3, 0.6, nil},
+	}
+	for _, tt := range tests {
+		got := m.Suggest(tt.name, tt.limit, tt.min)
+		if len(got) != len(tt.want) {
+			t.Errorf("Suggest(%q) = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Name != tt.want[i] {
+				t.Errorf("Suggest(%q)[%d] = %v, want %s", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestSuggestIdenticalScoresOne(t *testing.T) {
+	got := New("cane sugar").Suggest("Cane-Sugars", 1, 0)
+	if len(got) != 1 || got[0].Score != 1 {
+		t.Errorf("Suggest = %v, want cane sugar scoring 1", got)
+	}
+}
+
+func TestSuggestOncePerTarget(t *testing.T) {
+	m := New("sugar")
+	m.Add("sugars", "sugar")
+	m.Add("sugar cane", "sugar")
+	got := m.Suggest("sugar", 5, 0)
+	if len(got) != 1 || got[0].Score != 1 {
+		t.Errorf("Suggest = %v, want sugar once with its best score", got)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	if got := (Suggestion{Score: 0.876}).Percent(); got != "88%" {
+		t.Errorf("Percent = %q, want 88%%", got)
+	}
+}
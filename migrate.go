@@ -0,0 +1,89 @@
+package main
+
+import (
+	"IngredientGrader/auth"
+	"IngredientGrader/data"
+	"IngredientGrader/server"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// runMigrate implements the migrate subcommand
+/*	migrate up - applies every pending migration
+	migrate down [n] - reverts the last n applied migrations, 1 if n is omitted
+	migrate status - lists every migration and when it was applied
+*/
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s migrate up|down [n]|status", os.Args[0])
+	}
+	if err := data.Init(); err != nil {
+		return err
+	}
+	defer data.DB.Close()
+
+	switch args[0] {
+	case "up":
+		done, err := data.MigrateUp()
+		for _, m := range done {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("migrate down: %q is not a positive number", args[1])
+			}
+			steps = n
+		}
+		done, err := data.MigrateDown(steps)
+		for _, m := range done {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		list, err := data.Migrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range list {
+			state := "pending"
+			if m.Applied() {
+				state = "applied " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", m.Version, m.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("migrate: unknown command %q", args[0])
+	}
+}
+
+// runRole implements the role subcommand, which sets a user's role from
+/* the command line. It is how the first admin is made. The change is
+   recorded in the audit log under server.CLIActor
+	role <username> <viewer|contributor|grader|admin>
+*/
+func runRole(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s role <username> <viewer|contributor|grader|admin>", os.Args[0])
+	}
+	if !auth.Role(args[1]).Valid() {
+		return fmt.Errorf("role: %q is not one of %v", args[1], auth.Roles)
+	}
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	if err := server.Audited(store, server.CLIActor).SetRole(args[0], args[1]); err != nil {
+		return fmt.Errorf("role: %s: %v", args[0], err)
+	}
+	fmt.Printf("%s is now %s\n", args[0], args[1])
+	return nil
+}
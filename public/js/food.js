@@ -8,13 +8,15 @@ window.onload = colorRows();
 document.getElementById("name").onclick = function() {
     var rowGrades = document.getElementsByClassName("grade"); 
     var rowNames = document.getElementsByClassName("name");
+    var rowWeights = document.getElementsByClassName("weight");
     
     var list = []; 
     var nameList = []; 
     for (var i = 0; i < rowGrades.length; i++) {
         var n = rowNames[i].innerHTML; 
         var g = rowGrades[i].innerHTML; 
-        tempObj = {name: n, grade: g}; 
+        var w = rowWeights[i].innerHTML; 
+        tempObj = {name: n, grade: g, weight: w}; 
         list.push(tempObj); 
         nameList.push(n); 
     }
@@ -25,6 +27,7 @@ document.getElementById("name").onclick = function() {
     for (var i = 0; i < templist.length; i++) {
         rowNames[i].innerHTML = templist[i].name; 
         rowGrades[i].innerHTML = templist[i].grade; 
+        rowWeights[i].innerHTML = templist[i].weight; 
     }
     colorRows(); 
     
@@ -33,12 +36,14 @@ document.getElementById("name").onclick = function() {
 document.getElementById("grade").onclick = function() {
     var rowGrades = document.getElementsByClassName("grade"); 
     var rowNames = document.getElementsByClassName("name");
+    var rowWeights = document.getElementsByClassName("weight");
     
     var list = []; 
     for (var i = 0; i < rowGrades.length; i++) {
         var n = rowNames[i].innerHTML; 
         var g = rowGrades[i].innerHTML; 
-        tempObj = {name: n, grade: g}; 
+        var w = rowWeights[i].innerHTML; 
+        tempObj = {name: n, grade: g, weight: w}; 
         list.push(tempObj); 
     }
 
@@ -48,6 +53,7 @@ document.getElementById("grade").onclick = function() {
     for (var i = 0; i < templist.length; i++) {
         rowNames[i].innerHTML = templist[i].name; 
         rowGrades[i].innerHTML = templist[i].grade; 
+        rowWeights[i].innerHTML = templist[i].weight; 
     }
     
     colorRows(); 
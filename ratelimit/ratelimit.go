@@ -0,0 +1,169 @@
+package ratelimit
+
+/* Package ratelimit limits how often each client may make requests, with
+   a token bucket per client. A bucket holds up to Burst tokens and refills
+   at Rate tokens a second; every request takes one, and requests that find
+   the bucket empty are refused until it refills. Buckets live in memory, so
+   with several instances each one allows the full rate.
+*/
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how often buckets that have refilled are thrown away
+const sweepEvery = time.Minute
+
+// Limit is how fast a client may make requests
+/*	Rate - Requests allowed per second, on average
+	Burst - Requests allowed at once after a quiet spell
+*/
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit reads a Limit written as count/unit, such as 60/m, where unit
+/* is s, m or h, optionally followed by ,burst. The burst defaults to the
+   count, so 60/m allows 60 requests at once and one a second after that
+*/
+func ParseLimit(s string) (Limit, error) {
+	rate, burst := s, ""
+	if i := strings.Index(s, ","); i >= 0 {
+		rate, burst = s[:i], s[i+1:]
+	}
+	parts := strings.Split(rate, "/")
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("ratelimit: %q is not of the form count/unit", s)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || count < 1 {
+		return Limit{}, fmt.Errorf("ratelimit: %q does not start with a positive count", s)
+	}
+	var per time.Duration
+	switch strings.TrimSpace(parts[1]) {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("ratelimit: %q must be per s, m or h", s)
+	}
+	l := Limit{Rate: float64(count) / per.Seconds(), Burst: count}
+	if burst != "" {
+		if l.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || l.Burst < 1 {
+			return Limit{}, fmt.Errorf("ratelimit: %q has a bad burst", s)
+		}
+	}
+	return l, nil
+}
+
+// Result is the state of a client's bucket after a request
+/*	Allowed - Whether the request may go ahead
+	Limit - The size of the bucket
+	Remaining - How many more requests are allowed straight away
+	Reset - How long until the bucket is full again
+	RetryAfter - How long until the next request is allowed, 0 if it
+	already is
+*/
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// bucket is one client's tokens as of last
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a bucket for every client. It is safe for concurrent use
+type Limiter struct {
+	mu        sync.Mutex
+	limit     Limit
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New returns a Limiter that allows each client limit
+func New(limit Limit) *Limiter {
+	return &Limiter{limit: limit, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// Take spends one of key's tokens, if it has one, and reports the state of
+// its bucket
+func (l *Limiter) Take(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.sweep(now)
+
+	burst := float64(l.limit.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	res := Result{Limit: l.limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.after(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = l.after(burst - b.tokens)
+	return res
+}
+
+// after returns how long it takes to refill n tokens
+func (l *Limiter) after(n float64) time.Duration {
+	return time.Duration(n / l.limit.Rate * float64(time.Second))
+}
+
+// sweep throws away buckets that have refilled, since a new bucket would
+// be the same, so clients that have gone away do not use memory forever
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepEvery {
+		return
+	}
+	l.lastSweep = now
+	full := l.after(float64(l.limit.Burst))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// SetHeaders describes res to the client. X-RateLimit-Reset is the number
+/* of seconds until the bucket is full, and Retry-After, only sent when the
+   request was refused, the number until it may try again
+*/
+func SetHeaders(w http.ResponseWriter, res Result) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+	if !res.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+	}
+}
+
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Limit
+		ok   bool
+	}{
+		{"60/m", Limit{Rate: 1, Burst: 60}, true},
+		{"2/s", Limit{Rate: 2, Burst: 2}, true},
+		{"3600/h,10", Limit{Rate: 1, Burst: 10}, true},
+		{" 30 / m , 5 ", Limit{Rate: 0.5, Burst: 5}, true},
+		{"60", Limit{}, false},
+		{"0/m", Limit{}, false},
+		{"-1/m", Limit{}, false},
+		{"60/d", Limit{}, false},
+		{"60/m,0", Limit{}, false},
+		{"60/m,x", Limit{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseLimit(%q) error = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBurst(t *testing.T) {
+	l := New(Limit{Rate: 1, Burst: 3})
+	for i := 0; i < 3; i++ {
+		res := l.Take("a")
+		if !res.Allowed || res.Remaining != 2-i || res.Limit != 3 {
+			t.Fatalf("request %d: %+v, want allowed with %d remaining", i+1, res, 2-i)
+		}
+	}
+	res := l.Take("a")
+	if res.Allowed || res.Remaining != 0 {
+		t.Fatalf("request past the burst: %+v, want refused", res)
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > time.Second {
+		t.Errorf("RetryAfter = %v, want up to a second", res.RetryAfter)
+	}
+	if !l.Take("b").Allowed {
+		t.Error("another client shares a's bucket")
+	}
+}
+
+// backdate moves key's last refill d into the past, as if d had passed
+func backdate(l *Limiter, key string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets[key].last = l.buckets[key].last.Add(-d)
+}
+
+func TestRefill(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		allowed int
+	}{
+		{"no time", 0, 0},
+		{"half a token", 500 * time.Millisecond, 0},
+		{"one token", time.Second, 1},
+		{"two tokens", 2 * time.Second, 2},
+		{"capped at the burst", time.Hour, 4},
+	}
+	for _, tt := range tests {
+		l := New(Limit{Rate: 1, Burst: 4})
+		for i := 0; i < 4; i++ {
+			l.Take("a")
+		}
+		backdate(l, "a", tt.elapsed)
+		allowed := 0
+		for l.Take("a").Allowed {
+			allowed++
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: %d requests allowed after refilling, want %d", tt.name, allowed, tt.allowed)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	l := New(Limit{Rate: 1, Burst: 2})
+	l.Take("a")
+	backdate(l, "a", time.Hour)
+	l.lastSweep = l.lastSweep.Add(-2 * sweepEvery)
+	l.Take("b")
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("a full bucket survived the sweep")
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetHeaders(w, Result{Allowed: false, Limit: 5, Remaining: 0, Reset: 4500 * time.Millisecond, RetryAfter: 200 * time.Millisecond})
+	want := map[string]string{"X-RateLimit-Limit": "5", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "5", "Retry-After": "1"}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+	w = httptest.NewRecorder()
+	SetHeaders(w, Result{Allowed: true, Limit: 5, Remaining: 4})
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Retry-After = %q on an allowed request", got)
+	}
+}
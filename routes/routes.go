@@ -1,7 +1,12 @@
 package routes
 
 import (
+	"IngredientGrader/api"
+	"IngredientGrader/auth"
 	"IngredientGrader/handler"
+	"IngredientGrader/ratelimit"
+	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -9,22 +14,98 @@ import (
 // Router is the router for the site
 var Router *mux.Router
 
+// Limits are the request rate limits for each kind of request. A nil
+/* Limiter leaves that kind unlimited
+	Lookup - Food lookups at /food
+	API - Everything under /api/ that is not a Login request
+	Login - Attempts to sign in, register or reset a password, through the
+	pages or the API
+*/
+type Limits struct {
+	Lookup *ratelimit.Limiter
+	API    *ratelimit.Limiter
+	Login  *ratelimit.Limiter
+}
+
+// loginPaths are the pages and API calls limited by Limits.Login when POSTed
+var loginPaths = map[string]bool{
+	"/login": true, "/login/code": true, "/register": true, "/forgot": true, "/reset": true,
+	"/api/v1/users": true, "/api/v1/password/forgot": true, "/api/v1/password/reset": true,
+}
+
 // InitRoutes initializes the routers for the web server
-// for this site. This must be called first OR after a
-// connection to the database has been established
-func InitRoutes() {
+// for this site. h and a carry the Store the page and API
+// handlers use, so the connection to the database must be
+// established first. sessions tells handlers who is signed in,
+// tokens does the same for scripts sending API tokens, csrf
+// turns away forged form POSTs and limits slows down clients
+// making too many requests
+func InitRoutes(h *handler.Handler, a *api.API, sessions *auth.Manager, tokens *auth.Tokens, csrf *auth.CSRF, limits Limits) {
 	Router = mux.NewRouter()
+	// Resolve the session cookie or bearer token before any handler runs
+	Router.Use(sessions.Middleware)
+	Router.Use(tokens.Middleware)
+	// Then count the request against its client's limit
+	Router.Use(limitRequests(limits, h))
+	// Check the CSRF token of anything that is not a GET
+	csrf.Failed = func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			api.DenyCSRF(w, r)
+			return
+		}
+		h.DenyCSRF(w, r)
+	}
+	// API calls without a session cookie, such as registering from the
+	// app, carry no credentials for another site to borrow
+	csrf.Exempt = func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/api/") && !sessions.HasCookie(r)
+	}
+	Router.Use(csrf.Middleware)
 	// Attach Routes
 
+	// Routes for the JSON API, under /api/v1
+	a.Mount(Router)
+
 	// Routes for public webpages
-	Router.HandleFunc("/food", handler.HandleFood).Methods("GET")
-	Router.HandleFunc("/about", handler.HandleAbout).Methods("GET")
-	Router.HandleFunc("/login", handler.HandleLogin).Methods("GET", "POST")
-	Router.HandleFunc("/", handler.HandleLanding).Methods("GET")
+	Router.HandleFunc("/food", h.HandleFood).Methods("GET")
+	Router.HandleFunc("/about", h.HandleAbout).Methods("GET")
+	Router.HandleFunc("/login", h.HandleLogin).Methods("GET", "POST")
+	Router.HandleFunc("/login/code", h.HandleLoginCode).Methods("GET", "POST")
+	Router.HandleFunc("/logout", h.HandleLogout).Methods("POST")
+	Router.HandleFunc("/register", h.HandleRegister).Methods("GET", "POST")
+	Router.HandleFunc("/forgot", h.HandleForgot).Methods("GET", "POST")
+	Router.HandleFunc("/reset", h.HandleReset).Methods("GET", "POST")
+	Router.HandleFunc("/", h.HandleLanding).Methods("GET")
+
+	// Routes for signed-in users
+	account := restricted("/account", auth.Viewer, h)
+	account.HandleFunc("", h.HandleAccount).Methods("GET", "POST")
+	account.HandleFunc("/2fa", h.HandleTwoFactor).Methods("GET", "POST")
+	account.HandleFunc("/2fa/qr", h.TwoFactorQR).Methods("GET")
+	account.HandleFunc("/tokens", h.HandleTokens).Methods("GET", "POST")
+
+	// Routes for Admin Pages, grouped by the role they need
+	foods := restricted("/admin/food", auth.Contributor, h)
+	foods.HandleFunc("", h.ManageFoods).Methods("GET")
+	foods.HandleFunc("/create", h.MakeFood).Methods("GET", "POST")
+	foods.HandleFunc("/{barcode}/edit", h.EditFood).Methods("GET", "POST")
 
-	// Routes for Admin Pages
-	Router.HandleFunc("/admin/food/create", handler.MakeFood).Methods("GET", "POST")
-	Router.HandleFunc("/admin/ingredient/create", handler.MakeIngredient).Methods("GET", "POST")
+	ingredients := restricted("/admin/ingredient", auth.Grader, h)
+	ingredients.HandleFunc("", h.ManageIngredients).Methods("GET")
+	ingredients.HandleFunc("/create", h.MakeIngredient).Methods("GET", "POST")
+	ingredients.HandleFunc("/{name}/edit", h.EditIngredient).Methods("GET", "POST")
+
+	missing := restricted("/admin/missing", auth.Grader, h)
+	missing.HandleFunc("", h.Triage).Methods("GET", "POST")
+
+	admin := restricted("/admin", auth.Admin, h)
+	admin.HandleFunc("/regrade", h.RegradeFoods).Methods("GET", "POST")
+	admin.HandleFunc("/food/{barcode}/delete", h.DeleteFood).Methods("GET", "POST")
+	admin.HandleFunc("/ingredient/{name}/delete", h.DeleteIngredient).Methods("GET", "POST")
+	admin.HandleFunc("/aliases", h.ManageAliases).Methods("GET", "POST")
+	admin.HandleFunc("/users", h.ManageUsers).Methods("GET", "POST")
+	admin.HandleFunc("/lockouts", h.ManageLockouts).Methods("GET", "POST")
+	admin.HandleFunc("/audit", h.AuditLog).Methods("GET")
 
 	// Routes for misc
 	Router.HandleFunc("/public/{dir}/{file}/", handler.HandlePublic).Methods("GET")
@@ -33,3 +114,44 @@ func InitRoutes() {
 	var i handler.Foo
 	Router.NotFoundHandler = i
 }
+
+// limitRequests returns middleware that counts each request against the
+/* limit for its kind, keyed by auth.ClientKey, and refuses it with 429
+   once the client has run out
+*/
+func limitRequests(limits Limits, h *handler.Handler) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var limiter *ratelimit.Limiter
+			switch {
+			case r.Method == "POST" && loginPaths[r.URL.Path]:
+				limiter = limits.Login
+			case strings.HasPrefix(r.URL.Path, "/api/"):
+				limiter = limits.API
+			case r.URL.Path == "/food":
+				limiter = limits.Lookup
+			}
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			res := limiter.Take(auth.ClientKey(r))
+			ratelimit.SetHeaders(w, res)
+			if res.Allowed {
+				next.ServeHTTP(w, r)
+			} else if strings.HasPrefix(r.URL.Path, "/api/") {
+				api.TooManyRequests(w, r, res.RetryAfter)
+			} else {
+				h.TooManyRequests(w, r, res.RetryAfter)
+			}
+		})
+	}
+}
+
+// restricted returns a subrouter for the pages under prefix that only
+// users with at least role can reach
+func restricted(prefix string, role auth.Role, h *handler.Handler) *mux.Router {
+	sub := Router.PathPrefix(prefix).Subrouter()
+	sub.Use(auth.RequireRole(role, h.Deny))
+	return sub
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"IngredientGrader/auth"
+	"IngredientGrader/data"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+)
+
+/* Checks and steps shared by the registration and account pages and the
+   API, so both accept exactly the same usernames and passwords. Like the
+   catalog checks, problems are returned as the messages printed to the page.
+*/
+
+// MinPasswordLength is the shortest password CheckPassword accepts
+const MinPasswordLength = 10
+
+// maxPasswordLength is the longest password bcrypt will hash
+const maxPasswordLength = 72
+
+// commonPasswords are refused outright, whatever their length or mix of
+// characters
+var commonPasswords = map[string]bool{
+	"password123": true, "password1!": true, "Password123": true, "Password1!": true,
+	"1234567890": true, "qwertyuiop": true, "Qwerty1234": true, "iloveyou12": true,
+	"letmein123": true, "Welcome123": true, "welcome123": true, "Passw0rd!!": true,
+	"administrator": true, "Administrator1": true, "Admin12345": true, "changeme123": true,
+}
+
+// ErrHashFailed is returned when a password could not be hashed
+var ErrHashFailed = errors.New("server: password could not be hashed")
+
+// CheckUsername validates a username before an account is created
+/* username - Must be present, at most 64 characters, and made only of
+	   letters, numbers, '.', '_' and '-'
+*/
+func CheckUsername(username string) []string {
+	if len(username) == 0 {
+		return []string{"Username Field cannot be empty"}
+	}
+	var problems []string
+	if len(username) > 64 {
+		problems = append(problems, "Username must be 64 characters or fewer")
+	}
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '_' && r != '-' {
+			problems = append(problems, "Username may only contain letters, numbers, '.', '_' and '-'")
+			break
+		}
+	}
+	return problems
+}
+
+// CheckEmail validates an email address. An empty address is allowed, but
+// the account will not be able to reset a forgotten password
+func CheckEmail(email string) []string {
+	if len(email) == 0 {
+		return nil
+	}
+	if len(email) > 254 {
+		return []string{"Email must be 254 characters or fewer"}
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return []string{"Email is not a valid address"}
+	}
+	return nil
+}
+
+// CheckPassword validates the strength of a new password
+/* username - The account the password is for; the password may not contain it
+   pass - Must be MinPasswordLength to 72 bytes long, use at least three of
+	   lowercase letters, uppercase letters, numbers and symbols, and not be
+	   a well known password
+*/
+func CheckPassword(username, pass string) []string {
+	if len(pass) == 0 {
+		return []string{"Password Field cannot be empty"}
+	}
+	var problems []string
+	if len(pass) < MinPasswordLength {
+		problems = append(problems, "Password must be at least 10 characters long")
+	}
+	if len(pass) > maxPasswordLength {
+		problems = append(problems, "Password must be 72 bytes or fewer")
+	}
+
+	var lower, upper, digit, symbol int
+	for _, r := range pass {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	if lower+upper+digit+symbol < 3 {
+		problems = append(problems, "Password must use at least three of: lowercase letters, uppercase letters, numbers and symbols")
+	}
+
+	if len(username) > 0 && strings.Contains(strings.ToLower(pass), strings.ToLower(username)) {
+		problems = append(problems, "Password cannot contain your username")
+	}
+	if commonPasswords[pass] {
+		problems = append(problems, "Password is too common")
+	}
+	return problems
+}
+
+// CheckPasswordChange validates a signed-in user's request to change their
+/* password
+   current - Must match the password stored for username
+   next - The new password; must pass CheckPassword and differ from current
+*/
+func CheckPasswordChange(store Store, username, current, next string) []string {
+	hash := store.GetHashedPassword(username)
+	if hash == "" || !PasswordMatch([]byte(hash), []byte(current)) {
+		return []string{"Current password is incorrect"}
+	}
+	problems := CheckPassword(username, next)
+	if current == next {
+		problems = append(problems, "New password must be different from the current one")
+	}
+	return problems
+}
+
+// Register creates a viewer account for username with the password pass.
+/* The username, password and email must already have passed CheckUsername,
+   CheckPassword and CheckEmail. ErrDuplicate is returned if the username
+   is taken
+*/
+func Register(store Store, username, pass, email string) (data.User, error) {
+	hash := Obfuscate([]byte(pass))
+	if hash == "" {
+		return data.User{}, ErrHashFailed
+	}
+	user := data.User{Username: username, Role: "viewer", Email: email}
+	return user, store.CreateUser(user, hash)
+}
+
+// SetPassword hashes pass and stores it as the password of username
+func SetPassword(store Store, username, pass string) error {
+	hash := Obfuscate([]byte(pass))
+	if hash == "" {
+		return ErrHashFailed
+	}
+	return store.SetHashedPassword(username, hash)
+}
+
+// CheckToken validates a new API token for a user with role
+/* name - Must be present and at most 64 characters
+   scope - Must be a role no higher than the user's own. viewer makes a
+	   read-only token
+*/
+func CheckToken(name, scope string, role auth.Role) []string {
+	var problems []string
+	if len(name) == 0 {
+		problems = append(problems, "Name Field cannot be empty")
+	} else if len(name) > 64 {
+		problems = append(problems, "Name must be 64 characters or fewer")
+	}
+	if !auth.Role(scope).Valid() {
+		problems = append(problems, fmt.Sprintf("%s is not a scope", scope))
+	} else if !role.Allows(auth.Role(scope)) {
+		problems = append(problems, fmt.Sprintf("Your role cannot make %s tokens", scope))
+	}
+	return problems
+}
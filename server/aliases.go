@@ -0,0 +1,51 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"fmt"
+)
+
+// CheckAlias returns every problem with making alias another name for the
+/* ingredient called canonical. Both names should already be trimmed and
+   lowercase
+*/
+func CheckAlias(alias, canonical string, store Store) []string {
+	var problems []string
+	if alias == "" {
+		problems = append(problems, "Alias Field cannot be empty")
+	}
+	if canonical == "" {
+		problems = append(problems, "Ingredient Field cannot be empty")
+	} else if canonical == alias {
+		problems = append(problems, "An ingredient cannot be an alias of itself")
+	} else if in := store.GetIngredient(canonical); in.Canonical != "" {
+		problems = append(problems, fmt.Sprintf("%s is itself an alias of %s", canonical, in.Canonical))
+	} else if in.Grade == -10 {
+		problems = append(problems, fmt.Sprintf("Ingredient %s does not exist", canonical))
+	}
+	if alias != "" && taken(store.GetIngredient(alias)) {
+		problems = append(problems, fmt.Sprintf("%s is already an ingredient or an alias", alias))
+	}
+	return problems
+}
+
+// AliasesOf returns the aliases that stand for the ingredient called name
+func AliasesOf(store Store, name string) ([]string, error) {
+	all, err := store.ListAliases()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, a := range all {
+		if a.Ingredient == name {
+			names = append(names, a.Name)
+		}
+	}
+	return names, nil
+}
+
+// taken reports whether the name in was looked up by is used, either by a
+// graded ingredient or by an alias, even one whose ingredient was deleted
+func taken(in data.Ingredient) bool {
+	return in.Grade != -10 || in.Canonical != ""
+}
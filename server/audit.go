@@ -0,0 +1,306 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* The audit log records who changed what. Handlers wrap the Store with
+   Audited for each request, so every change made through it, including
+   the regrades it sets off, is logged under the signed-in user without the
+   catalog and account code having to remember to.
+*/
+
+// Audit actions
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionRegrade  = "regrade"
+	ActionRole     = "role"
+	ActionPassword = "password"
+	ActionLogin    = "login"
+	ActionDismiss  = "dismiss"
+)
+
+// Audited entities
+const (
+	EntityFood       = "food"
+	EntityIngredient = "ingredient"
+	EntityUser       = "user"
+	EntitySettings   = "settings"
+	EntityAlias      = "alias"
+)
+
+// CLIActor is the actor recorded for changes made from the command line
+const CLIActor = "cli"
+
+// DefaultAuditLimit is how many entries a listing returns when no limit is
+// given, and MaxAuditLimit the most it will return
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// Audit appends an entry to store's audit log. before and after are
+/* encoded as JSON; nil leaves them out. The change has already happened,
+   so a failure to record it is logged rather than returned
+*/
+func Audit(store Store, actor, action, entity, id string, before, after interface{}) {
+	e := data.AuditEntry{At: time.Now(), Actor: actor, Action: action, Entity: entity, EntityID: id}
+	e.Before, e.After = auditJSON(before), auditJSON(after)
+	if err := store.RecordAudit(e); err != nil {
+		log.Println("server.Audit: ", err)
+	}
+}
+
+// auditJSON encodes v for the audit log, or returns nil if v is nil
+func auditJSON(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Println("server.Audit: ", err)
+		return nil
+	}
+	return b
+}
+
+// AuditFilterFrom reads an audit log filter from the entity, id, actor,
+/* before and limit query parameters of a page or API request. The limit
+   defaults to DefaultAuditLimit and is capped at MaxAuditLimit
+*/
+func AuditFilterFrom(q url.Values) data.AuditFilter {
+	filter := data.AuditFilter{
+		Entity:   strings.Trim(q.Get("entity"), " "),
+		EntityID: strings.Trim(q.Get("id"), " "),
+		Actor:    strings.Trim(q.Get("actor"), " "),
+	}
+	filter.Before, _ = strconv.ParseInt(q.Get("before"), 10, 64)
+	filter.Limit, _ = strconv.Atoi(q.Get("limit"))
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultAuditLimit
+	}
+	if filter.Limit > MaxAuditLimit {
+		filter.Limit = MaxAuditLimit
+	}
+	return filter
+}
+
+// auditedStore is a Store that records the changes made through it
+type auditedStore struct {
+	Store
+	actor string
+}
+
+// Audited returns a Store that passes everything through to store and
+/* records each change to the catalog and to accounts in its audit log
+   under actor. Passwords are logged as changed but never with their hashes,
+   and two-factor secrets are not logged
+*/
+func Audited(store Store, actor string) Store {
+	return &auditedStore{Store: store, actor: actor}
+}
+
+// record appends an entry to the audit log under the store's actor
+func (s *auditedStore) record(action, entity, id string, before, after interface{}) {
+	Audit(s.Store, s.actor, action, entity, id, before, after)
+}
+
+// food returns the stored food with barcode for the log, or nil
+func (s *auditedStore) food(barcode string) interface{} {
+	if f, ok := s.Store.GetFood(barcode); ok {
+		return f
+	}
+	return nil
+}
+
+// ingredient returns the stored ingredient called name for the log, or nil
+func (s *auditedStore) ingredient(name string) interface{} {
+	if in := s.Store.GetIngredient(name); in.Grade != -10 {
+		return in
+	}
+	return nil
+}
+
+// alias returns the stored alias for the log, or nil
+func (s *auditedStore) alias(alias string) interface{} {
+	if in := s.Store.GetIngredient(alias); in.Canonical != "" {
+		return data.Alias{Name: alias, Ingredient: in.Canonical}
+	}
+	return nil
+}
+
+// user returns the account called username for the log, or nil
+func (s *auditedStore) user(username string) interface{} {
+	if u, ok := s.Store.GetUser(username); ok {
+		return u
+	}
+	return nil
+}
+
+// CreateFood creates food and records a food create with the food as saved
+func (s *auditedStore) CreateFood(food data.Food) error {
+	if err := s.Store.CreateFood(food); err != nil {
+		return err
+	}
+	s.record(ActionCreate, EntityFood, food.Barcode, nil, s.food(food.Barcode))
+	return nil
+}
+
+// UpdateFood saves food and records a food update with the food before and after
+func (s *auditedStore) UpdateFood(food data.Food) error {
+	before := s.food(food.Barcode)
+	if err := s.Store.UpdateFood(food); err != nil {
+		return err
+	}
+	s.record(ActionUpdate, EntityFood, food.Barcode, before, s.food(food.Barcode))
+	return nil
+}
+
+// DeleteFood deletes the food and records a food delete with the food as it was
+func (s *auditedStore) DeleteFood(barcode string) error {
+	before := s.food(barcode)
+	if err := s.Store.DeleteFood(barcode); err != nil {
+		return err
+	}
+	s.record(ActionDelete, EntityFood, barcode, before, nil)
+	return nil
+}
+
+// UpdateFoodGrade stores a new grade and records a food regrade with the food
+// before and after
+func (s *auditedStore) UpdateFoodGrade(barcode, grade string, numGrade float64) error {
+	before := s.food(barcode)
+	if err := s.Store.UpdateFoodGrade(barcode, grade, numGrade); err != nil {
+		return err
+	}
+	s.record(ActionRegrade, EntityFood, barcode, before, s.food(barcode))
+	return nil
+}
+
+// CreateIngredient creates the ingredient and records an ingredient create
+func (s *auditedStore) CreateIngredient(name string, grade int) error {
+	if err := s.Store.CreateIngredient(name, grade); err != nil {
+		return err
+	}
+	s.record(ActionCreate, EntityIngredient, name, nil, s.ingredient(name))
+	return nil
+}
+
+// UpdateIngredient saves in over name and records an ingredient update with
+// the ingredient before and after
+func (s *auditedStore) UpdateIngredient(name string, in data.Ingredient) error {
+	before := s.ingredient(name)
+	if err := s.Store.UpdateIngredient(name, in); err != nil {
+		return err
+	}
+	s.record(ActionUpdate, EntityIngredient, name, before, s.ingredient(in.Name))
+	return nil
+}
+
+// DeleteIngredient deletes the ingredient and records an ingredient delete,
+// and an alias delete for each of its aliases, which go with it
+func (s *auditedStore) DeleteIngredient(name string) error {
+	before := s.ingredient(name)
+	aliases, err := AliasesOf(s.Store, name)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.DeleteIngredient(name); err != nil {
+		return err
+	}
+	s.record(ActionDelete, EntityIngredient, name, before, nil)
+	for _, alias := range aliases {
+		s.record(ActionDelete, EntityAlias, alias, data.Alias{Name: alias, Ingredient: name}, nil)
+	}
+	return nil
+}
+
+// CreateAlias creates the alias and records an alias create
+func (s *auditedStore) CreateAlias(alias, ingredient string) error {
+	if err := s.Store.CreateAlias(alias, ingredient); err != nil {
+		return err
+	}
+	s.record(ActionCreate, EntityAlias, alias, nil, data.Alias{Name: alias, Ingredient: ingredient})
+	return nil
+}
+
+// DeleteAlias deletes the alias and records an alias delete
+func (s *auditedStore) DeleteAlias(alias string) error {
+	before := s.alias(alias)
+	if err := s.Store.DeleteAlias(alias); err != nil {
+		return err
+	}
+	s.record(ActionDelete, EntityAlias, alias, before, nil)
+	return nil
+}
+
+// CreateUser creates the account and records a user create, without the hash
+func (s *auditedStore) CreateUser(user data.User, hash string) error {
+	if err := s.Store.CreateUser(user, hash); err != nil {
+		return err
+	}
+	s.record(ActionCreate, EntityUser, user.Username, nil, s.user(user.Username))
+	return nil
+}
+
+// SetRole changes the account's role and records a user role change
+func (s *auditedStore) SetRole(username, role string) error {
+	before := s.user(username)
+	if err := s.Store.SetRole(username, role); err != nil {
+		return err
+	}
+	s.record(ActionRole, EntityUser, username, before, s.user(username))
+	return nil
+}
+
+// SetHashedPassword changes the password and records a user password change,
+// with neither hash
+func (s *auditedStore) SetHashedPassword(username, hash string) error {
+	if err := s.Store.SetHashedPassword(username, hash); err != nil {
+		return err
+	}
+	s.record(ActionPassword, EntityUser, username, nil, nil)
+	return nil
+}
+
+// SetEmail changes the account's email and records a user update
+func (s *auditedStore) SetEmail(username, email string) error {
+	before := s.user(username)
+	if err := s.Store.SetEmail(username, email); err != nil {
+		return err
+	}
+	s.record(ActionUpdate, EntityUser, username, before, s.user(username))
+	return nil
+}
+
+// SetDisabled disables or enables the account and records a user update
+func (s *auditedStore) SetDisabled(username string, disabled bool) error {
+	before := s.user(username)
+	if err := s.Store.SetDisabled(username, disabled); err != nil {
+		return err
+	}
+	s.record(ActionUpdate, EntityUser, username, before, s.user(username))
+	return nil
+}
+
+// SetSettings saves settings and records a settings update with the
+// settings before and after
+func (s *auditedStore) SetSettings(settings data.Settings) error {
+	before, err := s.Store.GetSettings()
+	if err != nil {
+		return err
+	}
+	if err := s.Store.SetSettings(settings); err != nil {
+		return err
+	}
+	s.record(ActionUpdate, EntitySettings, "", before, settings)
+	return nil
+}
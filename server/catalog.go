@@ -0,0 +1,211 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"IngredientGrader/grading"
+	"IngredientGrader/statement"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* Checks and steps shared by everything that adds to or edits the
+   catalog, so the admin pages and the API accept exactly the same input.
+   Problems are returned as the messages printed to the page.
+*/
+
+// ParseIngredients reads an ingredient statement into its ungraded
+/* ingredients in label order, each with its sub-ingredients, using the
+   statement package
+*/
+func ParseIngredients(label string) []data.Ingredient {
+	return fromStatement(statement.Parse(label))
+}
+
+// fromStatement converts parsed ingredients into ungraded Ingredients
+func fromStatement(parsed []statement.Ingredient) []data.Ingredient {
+	if parsed == nil {
+		return nil
+	}
+	list := make([]data.Ingredient, len(parsed))
+	for i, p := range parsed {
+		list[i] = data.Ingredient{
+			Name:         p.Name,
+			Grade:        -10,
+			Percent:      p.Percent,
+			OrLess:       p.OrLess,
+			Alternatives: p.Alternatives,
+			Children:     fromStatement(p.Children),
+		}
+	}
+	return list
+}
+
+// CheckFood validates the fields of a food before it is saved
+/* barcode - Must be present and numeric
+   name - Must be present
+   label - The ingredient statement; must list at least one ingredient
+*/
+func CheckFood(barcode, name, label string) []string {
+	var problems []string
+	if len(barcode) == 0 {
+		problems = append(problems, "Barcode Field cannot be empty")
+	} else if _, err := strconv.Atoi(barcode); err != nil {
+		problems = append(problems, "Barcode must be an integer")
+	}
+	if len(name) == 0 {
+		problems = append(problems, "Name Field cannot be empty")
+	}
+	if len(strings.Trim(label, " ")) == 0 {
+		problems = append(problems, "Ingredients Field cannot be empty")
+	} else if len(ParseIngredients(label)) == 0 {
+		problems = append(problems, "Ingredients Field must list at least one ingredient")
+	}
+	return problems
+}
+
+// CheckIngredient validates the fields of an ingredient before it is saved
+/* name - Must be present
+   grade - Must be an integer between -5 and 5, inclusive
+   return - The parsed grade and any problems found
+*/
+func CheckIngredient(name, grade string) (int, []string) {
+	var problems []string
+	if len(name) == 0 {
+		problems = append(problems, "Name Field cannot be empty")
+	}
+	if len(grade) == 0 {
+		return 0, append(problems, "Grade Field cannot be empty")
+	}
+	g, err := strconv.Atoi(grade)
+	if err != nil {
+		return 0, append(problems, "Grade could not be parsed. Check to make sure it is a number")
+	}
+	if g < -5 || g > 5 {
+		problems = append(problems, "The grade must be an integer between -5 and 5, inclusive")
+	}
+	return g, problems
+}
+
+// GradeFood looks up the current grade of each of food's ingredients and
+/* sub-ingredients and grades the food with strategy from its top-level
+   ingredients. The grades already in food.Ingredients are ignored
+   return - The food with its ingredient grades, including those strategy
+   worked out for compound ingredients, Grade and NumGrade filled in
+*/
+func GradeFood(store Store, strategy grading.Strategy, food data.Food) data.Food {
+	result := strategy.Grade(lookUpGrades(store, food.Ingredients))
+	food.Ingredients = result.Ingredients
+	food.Grade, food.NumGrade = result.Category, result.Score
+	return food
+}
+
+// lookUpGrades returns a copy of list with the current grade of each
+// ingredient and sub-ingredient, resolving aliases
+func lookUpGrades(store Store, list []data.Ingredient) []data.Ingredient {
+	if list == nil {
+		return nil
+	}
+	graded := make([]data.Ingredient, len(list))
+	for i, in := range list {
+		found := store.GetIngredient(in.Name)
+		in.Grade, in.Canonical, in.Derived = found.Grade, found.Canonical, false
+		in.Children = lookUpGrades(store, in.Children)
+		graded[i] = in
+	}
+	return graded
+}
+
+// AddFood grades food, saves it, and records any of its ingredients that
+/* have no grade yet. Unknown ingredients close enough to a graded one are
+   first made its aliases, as the AutoMatch setting allows. food should
+   already have passed CheckFood
+   return - The food as it was saved, or ErrDuplicate if the barcode is taken
+*/
+func AddFood(store Store, strategy grading.Strategy, food data.Food) (data.Food, error) {
+	// Refuse a taken barcode before anything is matched for the food
+	if _, ok := store.GetFood(food.Barcode); ok {
+		return food, ErrDuplicate
+	}
+	autoMatch(store, food)
+	food = GradeFood(store, strategy, food)
+	if err := store.CreateFood(food); err != nil {
+		return food, err
+	}
+	return food, recordMissing(store, strategy, food, nil)
+}
+
+// EditFood regrades food and saves it over the food with the same barcode,
+/* recording the ingredients it did not list before that have no grade yet.
+   Unknown ingredients are matched as in AddFood. food should already have
+   passed CheckFood
+   return - The food as it was saved, or ErrNotFound if there is no such food
+*/
+func EditFood(store Store, strategy grading.Strategy, food data.Food) (data.Food, error) {
+	previous, ok := store.GetFood(food.Barcode)
+	if !ok {
+		return food, ErrNotFound
+	}
+	autoMatch(store, food)
+	food = GradeFood(store, strategy, food)
+	if err := store.UpdateFood(food); err != nil {
+		return food, err
+	}
+	return food, recordMissing(store, strategy, food, listed(previous.Ingredients, nil))
+}
+
+// recordMissing records each ungraded ingredient of a saved food, except
+/* those in known, so saving a food again does not count the ingredients it
+   already listed twice
+   strategy - The strategy food was graded with. If it grades compounds
+   from their sub-ingredients, only the sub-ingredients are recorded
+   known - The names already recorded for this food. May be nil
+*/
+func recordMissing(store Store, strategy grading.Strategy, food data.Food, known map[string]bool) error {
+	return recordMissingIn(store, food.Barcode, food.Ingredients, known, grading.Fills(strategy))
+}
+
+// recordMissingIn records each ungraded ingredient of list that is not in
+/* known. The ungraded sub-ingredients of an ungraded compound are recorded
+   too, and when fills is set they stand in for the compound, since grading
+   them is enough to grade it
+*/
+func recordMissingIn(store Store, barcode string, list []data.Ingredient, known map[string]bool, fills bool) error {
+	for _, in := range list {
+		if in.Grade != -10 {
+			continue
+		}
+		if !known[in.Name] && !(fills && len(in.Children) > 0) {
+			if err := store.RecordMissingIngredient(barcode, in.Name); err != nil {
+				return fmt.Errorf("recording missing ingredient %s: %v", in.Name, err)
+			}
+		}
+		if err := recordMissingIn(store, barcode, in.Children, known, fills); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listed adds the name of every ingredient and sub-ingredient of list to
+// names, which is made if nil, and returns it
+func listed(list []data.Ingredient, names map[string]bool) map[string]bool {
+	if names == nil {
+		names = make(map[string]bool)
+	}
+	for _, in := range list {
+		names[in.Name] = true
+		listed(in.Children, names)
+	}
+	return names
+}
+
+// NamesToIngredients wraps a list of ingredient names as ungraded
+// Ingredients, ready for GradeFood
+func NamesToIngredients(names []string) []data.Ingredient {
+	list := make([]data.Ingredient, len(names))
+	for i, name := range names {
+		list[i] = data.Ingredient{Name: name, Grade: -10}
+	}
+	return list
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"IngredientGrader/match"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// SuggestLimit is how many suggestions are made for each unknown
+// ingredient, and SuggestMin the lowest score worth suggesting
+const (
+	SuggestLimit = 3
+	SuggestMin   = 0.6
+)
+
+// NewMatcher returns a match.Matcher that knows every graded ingredient
+// and alias in store, suggesting aliases as the ingredient they stand for
+func NewMatcher(store Store) (*match.Matcher, error) {
+	ingredients, err := store.ListIngredients()
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := store.ListAliases()
+	if err != nil {
+		return nil, err
+	}
+	m := match.New()
+	for _, in := range ingredients {
+		m.Add(in.Name, in.Name)
+	}
+	for _, a := range aliases {
+		m.Add(a.Name, a.Ingredient)
+	}
+	return m, nil
+}
+
+// suggestions returns the graded ingredients m finds name may mean, best
+// first, as they are printed for a missing ingredient
+func suggestions(m *match.Matcher, name string) []data.Suggestion {
+	found := m.Suggest(name, SuggestLimit, SuggestMin)
+	list := make([]data.Suggestion, len(found))
+	for i, s := range found {
+		list[i] = data.Suggestion{Name: s.Name, Score: s.Score}
+	}
+	return list
+}
+
+// Suggest returns each ungraded ingredient of food once, in label order,
+/* with the graded ingredients it may be another name for. The ungraded
+   sub-ingredients of an ungraded compound follow the compound, as they are
+   recorded missing with it
+*/
+func Suggest(store Store, food data.Food) ([]data.MissingIngredient, error) {
+	s := suggester{store: store, seen: make(map[string]bool)}
+	if err := s.walk(food.Ingredients); err != nil {
+		return nil, err
+	}
+	return s.list, nil
+}
+
+// suggester collects the suggestions for a food's ungraded ingredients
+type suggester struct {
+	store Store
+	m     *match.Matcher
+	seen  map[string]bool
+	list  []data.MissingIngredient
+}
+
+// walk adds the suggestions for the ungraded ingredients of list and of
+// their sub-ingredients
+func (s *suggester) walk(list []data.Ingredient) error {
+	for _, in := range list {
+		if in.Grade != -10 {
+			continue
+		}
+		if !s.seen[in.Name] {
+			s.seen[in.Name] = true
+			if s.m == nil {
+				var err error
+				if s.m, err = NewMatcher(s.store); err != nil {
+					return err
+				}
+			}
+			s.list = append(s.list, data.MissingIngredient{
+				Name:        in.Name,
+				Suggestions: suggestions(s.m, in.Name),
+			})
+		}
+		if err := s.walk(in.Children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// autoMatch makes each unknown ingredient of food an alias of the graded
+/* ingredient it matches best, if that match scores at least the AutoMatch
+   setting. The sub-ingredients of an unknown compound that matches nothing
+   are matched in turn. It runs before a food is graded, so the food takes
+   the grades of the ingredients it was matched to. Failures are logged and
+   leave the ingredient unknown, as it would have been without matching
+*/
+func autoMatch(store Store, food data.Food) {
+	settings, err := store.GetSettings()
+	if err != nil {
+		log.Println("server.autoMatch: ", err)
+		return
+	}
+	if settings.AutoMatch <= 0 {
+		return
+	}
+	a := autoMatcher{store: store, min: settings.AutoMatch}
+	if err := a.walk(food.Ingredients); err != nil {
+		log.Println("server.autoMatch: ", err)
+	}
+}
+
+// autoMatcher aliases a food's unknown ingredients for autoMatch
+type autoMatcher struct {
+	store Store
+	min   float64
+	m     *match.Matcher
+}
+
+// walk aliases the unknown ingredients of list, and the sub-ingredients of
+// those that match nothing
+func (a *autoMatcher) walk(list []data.Ingredient) error {
+	for _, in := range list {
+		if taken(a.store.GetIngredient(in.Name)) {
+			continue
+		}
+		if a.m == nil {
+			var err error
+			if a.m, err = NewMatcher(a.store); err != nil {
+				return err
+			}
+		}
+		best := a.m.Suggest(in.Name, 1, a.min)
+		if len(best) == 0 {
+			if err := a.walk(in.Children); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := a.store.CreateAlias(in.Name, best[0].Name); err != nil && err != ErrDuplicate {
+			log.Println("server.autoMatch: ", err)
+		}
+	}
+	return nil
+}
+
+// CheckAutoMatch validates the AutoMatch setting before it is saved
+/* value - Must be a number from 0 to 1, inclusive. Empty means 0
+   return - The parsed value and any problems found
+*/
+func CheckAutoMatch(value string) (float64, []string) {
+	if value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || f > 1 {
+		return 0, []string{fmt.Sprintf("The automatic match threshold must be a number from 0 to 1, not %s", value)}
+	}
+	return f, nil
+}
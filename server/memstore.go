@@ -0,0 +1,588 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps the whole catalog in memory. Nothing
+/* is persisted, which makes it useful for running the site locally and in
+   tests without a database server.
+*/
+type MemoryStore struct {
+	mu          sync.RWMutex
+	foods       map[string]data.Food
+	ingredients map[string]int
+	missing     []missingRow
+	users       map[string]memUser
+	settings    data.Settings
+	audit       []data.AuditEntry
+	aliases     map[string]string
+}
+
+// missingRow is one record of an ungraded ingredient a food lists
+type missingRow struct {
+	barcode string
+	name    string
+}
+
+// memUser is an account as the MemoryStore keeps it
+type memUser struct {
+	data.User
+	hash  string
+	totp  data.TOTP
+	codes map[string]bool
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		foods:       make(map[string]data.Food),
+		ingredients: make(map[string]int),
+		users:       make(map[string]memUser),
+		aliases:     make(map[string]string),
+	}
+}
+
+// GetFood returns the food with a matching barcode
+func (m *MemoryStore) GetFood(barcode string) (data.Food, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, ok := m.foods[barcode]
+	if !ok {
+		return data.Food{}, false
+	}
+	return m.graded(f), true
+}
+
+// graded returns a copy of f with the current grade of each ingredient
+// and sub-ingredient. The caller must hold m.mu
+func (m *MemoryStore) graded(f data.Food) data.Food {
+	f.Ingredients = m.gradedTree(f.Ingredients)
+	return f
+}
+
+// gradedTree returns a copy of list with the current grade of each
+// ingredient. The caller must hold m.mu
+func (m *MemoryStore) gradedTree(list []data.Ingredient) []data.Ingredient {
+	if list == nil {
+		return nil
+	}
+	graded := make([]data.Ingredient, len(list))
+	for i, in := range list {
+		g := m.ingredient(in.Name)
+		in.Grade, in.Canonical, in.Derived = g.Grade, g.Canonical, false
+		in.Children = m.gradedTree(in.Children)
+		graded[i] = in
+	}
+	return graded
+}
+
+// copyTree returns a deep copy of list, so foods in the store do not
+// share ingredient lists with their callers
+func copyTree(list []data.Ingredient) []data.Ingredient {
+	if list == nil {
+		return nil
+	}
+	c := make([]data.Ingredient, len(list))
+	for i, in := range list {
+		in.Children = copyTree(in.Children)
+		c[i] = in
+	}
+	return c
+}
+
+// lists reports whether list or any of its sub-ingredients passes match
+func lists(list []data.Ingredient, match func(name string) bool) bool {
+	for _, in := range list {
+		if match(in.Name) || lists(in.Children, match) {
+			return true
+		}
+	}
+	return false
+}
+
+// renameTree renames every ingredient and sub-ingredient in list called
+// name to to, in place
+func renameTree(list []data.Ingredient, name, to string) {
+	for i := range list {
+		if list[i].Name == name {
+			list[i].Name = to
+		}
+		renameTree(list[i].Children, name, to)
+	}
+}
+
+// ingredient returns the ingredient called name, resolving aliases, or a
+// grade of -10 if it does not exist. The caller must hold m.mu
+func (m *MemoryStore) ingredient(name string) data.Ingredient {
+	in := data.Ingredient{Name: name, Grade: -10}
+	if canonical, ok := m.aliases[name]; ok {
+		in.Canonical = canonical
+	}
+	if grade, ok := m.ingredients[in.CanonicalName()]; ok {
+		in.Grade = grade
+	}
+	return in
+}
+
+// CreateFood adds a food to the catalog
+func (m *MemoryStore) CreateFood(food data.Food) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.foods[food.Barcode]; ok {
+		return ErrDuplicate
+	}
+	food.Ingredients = copyTree(food.Ingredients)
+	m.foods[food.Barcode] = food
+	return nil
+}
+
+// UpdateFood replaces the food with food.Barcode
+func (m *MemoryStore) UpdateFood(food data.Food) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.foods[food.Barcode]; !ok {
+		return ErrNotFound
+	}
+	food.Ingredients = copyTree(food.Ingredients)
+	m.foods[food.Barcode] = food
+	return nil
+}
+
+// DeleteFood removes the food with a matching barcode and the missing
+// ingredients recorded for it
+func (m *MemoryStore) DeleteFood(barcode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.foods[barcode]; !ok {
+		return ErrNotFound
+	}
+	delete(m.foods, barcode)
+	kept := m.missing[:0]
+	for _, row := range m.missing {
+		if row.barcode != barcode {
+			kept = append(kept, row)
+		}
+	}
+	m.missing = kept
+	return nil
+}
+
+// ListFoods returns every food in the catalog, ordered by barcode
+func (m *MemoryStore) ListFoods() ([]data.Food, error) {
+	return m.foodsWhere(func(data.Food) bool { return true }), nil
+}
+
+// FoodsContaining returns every food that lists the ingredient name or
+// one of its aliases, as an ingredient or a sub-ingredient
+func (m *MemoryStore) FoodsContaining(name string) ([]data.Food, error) {
+	return m.foodsWhere(func(f data.Food) bool {
+		return lists(f.Ingredients, func(n string) bool { return n == name || m.aliases[n] == name })
+	}), nil
+}
+
+// foodsWhere returns every food keep accepts, ordered by barcode
+func (m *MemoryStore) foodsWhere(keep func(data.Food) bool) []data.Food {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var foods []data.Food
+	for _, f := range m.foods {
+		if keep(f) {
+			foods = append(foods, m.graded(f))
+		}
+	}
+	sort.Slice(foods, func(i, j int) bool { return foods[i].Barcode < foods[j].Barcode })
+	return foods
+}
+
+// UpdateFoodGrade replaces the stored grade of a food
+func (m *MemoryStore) UpdateFoodGrade(barcode, grade string, numGrade float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.foods[barcode]
+	if !ok {
+		return nil
+	}
+	f.Grade, f.NumGrade = grade, numGrade
+	m.foods[barcode] = f
+	return nil
+}
+
+// GetIngredient returns the ingredient with a matching name, resolving
+// aliases, or a grade of -10 if it does not exist
+func (m *MemoryStore) GetIngredient(name string) data.Ingredient {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ingredient(name)
+}
+
+// CreateIngredient adds an ingredient to the catalog
+func (m *MemoryStore) CreateIngredient(name string, grade int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if taken(m.ingredient(name)) {
+		return ErrDuplicate
+	}
+	m.ingredients[name] = grade
+	return nil
+}
+
+// UpdateIngredient replaces the ingredient called name with in, renaming
+// it in every food and alias that lists it
+func (m *MemoryStore) UpdateIngredient(name string, in data.Ingredient) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.ingredients[name]; !ok {
+		return ErrNotFound
+	}
+	if in.Name != name && taken(m.ingredient(in.Name)) {
+		return ErrDuplicate
+	}
+	delete(m.ingredients, name)
+	m.ingredients[in.Name] = in.Grade
+	if in.Name == name {
+		return nil
+	}
+	for alias, canonical := range m.aliases {
+		if canonical == name {
+			m.aliases[alias] = in.Name
+		}
+	}
+	for bar, f := range m.foods {
+		f.Ingredients = copyTree(f.Ingredients)
+		renameTree(f.Ingredients, name, in.Name)
+		m.foods[bar] = f
+	}
+	return nil
+}
+
+// DeleteIngredient removes the ingredient called name and its aliases
+func (m *MemoryStore) DeleteIngredient(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.ingredients[name]; !ok {
+		return ErrNotFound
+	}
+	delete(m.ingredients, name)
+	for alias, target := range m.aliases {
+		if target == name {
+			delete(m.aliases, alias)
+		}
+	}
+	return nil
+}
+
+// ListIngredients returns every graded ingredient, ordered by name
+func (m *MemoryStore) ListIngredients() ([]data.Ingredient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]data.Ingredient, 0, len(m.ingredients))
+	for name, grade := range m.ingredients {
+		list = append(list, data.Ingredient{Name: name, Grade: grade})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// ListAliases returns every ingredient alias, ordered by alias
+func (m *MemoryStore) ListAliases() ([]data.Alias, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]data.Alias, 0, len(m.aliases))
+	for alias, name := range m.aliases {
+		list = append(list, data.Alias{Name: alias, Ingredient: name})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// CreateAlias makes alias another name for ingredient
+func (m *MemoryStore) CreateAlias(alias, ingredient string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, isIngredient := m.ingredients[alias]
+	_, isAlias := m.aliases[alias]
+	if isIngredient || isAlias {
+		return ErrDuplicate
+	}
+	m.aliases[alias] = ingredient
+	return nil
+}
+
+// DeleteAlias removes an alias
+func (m *MemoryStore) DeleteAlias(alias string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.aliases[alias]; !ok {
+		return ErrNotFound
+	}
+	delete(m.aliases, alias)
+	return nil
+}
+
+// RecordMissingIngredient records the name of an ungraded ingredient the
+// food with barcode lists
+func (m *MemoryStore) RecordMissingIngredient(barcode, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.missing = append(m.missing, missingRow{barcode: barcode, name: name})
+	return nil
+}
+
+// ClearMissingIngredient forgets every record of name as a missing ingredient
+func (m *MemoryStore) ClearMissingIngredient(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.missing[:0]
+	for _, row := range m.missing {
+		if row.name != name {
+			kept = append(kept, row)
+		}
+	}
+	m.missing = kept
+	return nil
+}
+
+// ListMissingIngredients returns each missing name once, ordered by name
+func (m *MemoryStore) ListMissingIngredients() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, row := range m.missing {
+		if !seen[row.name] {
+			seen[row.name] = true
+			names = append(names, row.name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CountMissingIngredients returns each missing name once with how many
+// times it was recorded, most recorded first
+func (m *MemoryStore) CountMissingIngredients() ([]data.MissingIngredient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, row := range m.missing {
+		counts[row.name]++
+	}
+	list := make([]data.MissingIngredient, 0, len(counts))
+	for name, n := range counts {
+		list = append(list, data.MissingIngredient{Name: name, Count: n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// GetHashedPassword returns the hash stored for username, or an empty string
+func (m *MemoryStore) GetHashedPassword(username string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.users[username].hash
+}
+
+// SetHashedPassword replaces the hash stored for username
+func (m *MemoryStore) SetHashedPassword(username, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	u.hash = hash
+	m.users[username] = u
+	return nil
+}
+
+// GetUser returns the account called username
+func (m *MemoryStore) GetUser(username string) (data.User, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[username]
+	return u.User, ok
+}
+
+// SetRole changes the role of the account called username
+func (m *MemoryStore) SetRole(username, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Role = role
+	m.users[username] = u
+	return nil
+}
+
+// CreateUser adds an account with the given password hash
+func (m *MemoryStore) CreateUser(user data.User, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user.Username]; ok {
+		return ErrDuplicate
+	}
+	m.users[user.Username] = memUser{User: user, hash: hash}
+	return nil
+}
+
+// SetEmail changes the email address of the account called username
+func (m *MemoryStore) SetEmail(username, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Email = email
+	m.users[username] = u
+	return nil
+}
+
+// SetDisabled disables or re-enables the account called username
+func (m *MemoryStore) SetDisabled(username string, disabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Disabled = disabled
+	m.users[username] = u
+	return nil
+}
+
+// ListUsers returns every account, ordered by username
+func (m *MemoryStore) ListUsers() ([]data.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]data.User, 0, len(m.users))
+	for _, u := range m.users {
+		list = append(list, u.User)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	return list, nil
+}
+
+// GetTOTP returns the two-factor sign-in state of username
+func (m *MemoryStore) GetTOTP(username string) (data.TOTP, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[username]
+	if !ok {
+		return data.TOTP{}, ErrNotFound
+	}
+	return u.totp, nil
+}
+
+// SetTOTP replaces the two-factor sign-in state of username
+func (m *MemoryStore) SetTOTP(username string, t data.TOTP) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	u.totp = t
+	u.TwoFactor = t.Enabled
+	m.users[username] = u
+	return nil
+}
+
+// UseTOTPStep records step as the last accepted step of username
+func (m *MemoryStore) UseTOTPStep(username string, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok || u.totp.LastStep >= step {
+		return false, nil
+	}
+	u.totp.LastStep = step
+	m.users[username] = u
+	return true, nil
+}
+
+// SetRecoveryCodes replaces the hashed recovery codes of username
+func (m *MemoryStore) SetRecoveryCodes(username string, hashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	u.codes = make(map[string]bool)
+	for _, hash := range hashes {
+		u.codes[hash] = true
+	}
+	m.users[username] = u
+	return nil
+}
+
+// UseRecoveryCode deletes a hashed recovery code of username
+func (m *MemoryStore) UseRecoveryCode(username, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok || !u.codes[hash] {
+		return false, nil
+	}
+	delete(u.codes, hash)
+	return true, nil
+}
+
+// CountRecoveryCodes returns how many recovery codes username has left
+func (m *MemoryStore) CountRecoveryCodes(username string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.users[username].codes), nil
+}
+
+// GetSettings returns the site-wide settings
+func (m *MemoryStore) GetSettings() (data.Settings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.settings, nil
+}
+
+// SetSettings replaces the site-wide settings
+func (m *MemoryStore) SetSettings(settings data.Settings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.settings = settings
+	return nil
+}
+
+// RecordAudit appends an entry to the audit log
+func (m *MemoryStore) RecordAudit(e data.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.ID = int64(len(m.audit) + 1)
+	m.audit = append(m.audit, e)
+	return nil
+}
+
+// ListAudit returns the entries that match filter, newest first
+func (m *MemoryStore) ListAudit(filter data.AuditFilter) ([]data.AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var entries []data.AuditEntry
+	for i := len(m.audit) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		e := m.audit[i]
+		if (filter.Entity == "" || e.Entity == filter.Entity) &&
+			(filter.EntityID == "" || e.EntityID == filter.EntityID) &&
+			(filter.Actor == "" || e.Actor == filter.Actor) &&
+			(filter.Before == 0 || e.ID < filter.Before) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"IngredientGrader/grading"
+	"IngredientGrader/jobs"
+	"context"
+	"log"
+)
+
+// RegradeFood grades food again from its current ingredient grades and
+/* stores the result if it changed. food should come from the Store so its
+   ingredient grades are up to date
+   return - The food with its new grade, and its ingredients as graded
+*/
+func RegradeFood(store Store, strategy grading.Strategy, food data.Food) (data.Food, error) {
+	result := strategy.Grade(food.Ingredients)
+	food.Ingredients = result.Ingredients
+	if result.Category == food.Grade && result.Score == food.NumGrade {
+		return food, nil
+	}
+	food.Grade, food.NumGrade = result.Category, result.Score
+	return food, store.UpdateFoodGrade(food.Barcode, food.Grade, food.NumGrade)
+}
+
+// RegradeFoodsContaining regrades every food that lists the ingredient
+/* name. It should be called whenever an ingredient is created, edited or
+   deleted. The missing table is brought in line as well: if name now has a
+   grade its rows are cleared, so foods that were waiting on it move from
+   "missing" to a real grade; if it was deleted, it is recorded as missing
+   for each food that still lists it, under the name the food lists it by
+   p - Receives the progress of the regrade. May be nil
+   return - The number of foods whose grade changed
+*/
+func RegradeFoodsContaining(ctx context.Context, store Store, strategy grading.Strategy, name string, p *jobs.Progress) (int, error) {
+	foods, err := store.FoodsContaining(name)
+	if err != nil {
+		return 0, err
+	}
+	if store.GetIngredient(name).Grade != -10 {
+		err = store.ClearMissingIngredient(name)
+	} else {
+		for _, f := range foods {
+			if err = recordListed(store, f.Barcode, f.Ingredients, name); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return regrade(ctx, store, strategy, foods, p)
+}
+
+// RegradeAll regrades every food in the catalog. Run it after changing
+/* the grading strategy or its configuration
+   p - Receives the progress of the regrade. May be nil
+   return - The number of foods whose grade changed
+*/
+func RegradeAll(ctx context.Context, store Store, strategy grading.Strategy, p *jobs.Progress) (int, error) {
+	foods, err := store.ListFoods()
+	if err != nil {
+		return 0, err
+	}
+	return regrade(ctx, store, strategy, foods, p)
+}
+
+// regrade runs RegradeFood over foods, stopping early if ctx is cancelled.
+/* A food that fails to save is logged and counted, and the rest carry on.
+   Missing ingredients a regraded food now has a grade for, its own or one
+   worked out from its sub-ingredients, are cleared from the triage queue
+*/
+func regrade(ctx context.Context, store Store, strategy grading.Strategy, foods []data.Food, p *jobs.Progress) (int, error) {
+	missing, err := missingNames(store)
+	if err != nil {
+		return 0, err
+	}
+	p.SetTotal(len(foods))
+	var changed int
+	for _, f := range foods {
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+		updated, err := RegradeFood(store, strategy, f)
+		if err != nil {
+			log.Println("server.regrade: ", f.Barcode, err)
+			p.Fail()
+			continue
+		}
+		if updated.Grade != f.Grade || updated.NumGrade != f.NumGrade {
+			changed++
+		}
+		if err := clearGraded(store, updated.Ingredients, missing); err != nil {
+			log.Println("server.regrade: ", f.Barcode, err)
+		}
+		p.Done()
+	}
+	return changed, nil
+}
+
+// RegradeAllTask wraps RegradeAll so it can be submitted to a jobs.Queue
+func RegradeAllTask(store Store, strategy grading.Strategy) jobs.Task {
+	return func(ctx context.Context, p *jobs.Progress) error {
+		_, err := RegradeAll(ctx, store, strategy, p)
+		return err
+	}
+}
+
+// RegradeContainingTask wraps RegradeFoodsContaining so it can be
+// submitted to a jobs.Queue
+func RegradeContainingTask(store Store, strategy grading.Strategy, name string) jobs.Task {
+	return func(ctx context.Context, p *jobs.Progress) error {
+		_, err := RegradeFoodsContaining(ctx, store, strategy, name, p)
+		return err
+	}
+}
+
+// recordListed records as missing each ingredient of list, or of its
+/* sub-ingredients, that is name or an alias of it and has no grade, under
+   the name the food with barcode lists it by
+*/
+func recordListed(store Store, barcode string, list []data.Ingredient, name string) error {
+	for _, in := range list {
+		if in.Grade == -10 && (in.Name == name || in.Canonical == name) {
+			if err := store.RecordMissingIngredient(barcode, in.Name); err != nil {
+				return err
+			}
+		}
+		if err := recordListed(store, barcode, in.Children, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingNames returns the names in the triage queue
+func missingNames(store Store) (map[string]bool, error) {
+	list, err := store.CountMissingIngredients()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(list))
+	for _, in := range list {
+		names[in.Name] = true
+	}
+	return names, nil
+}
+
+// clearGraded clears each ingredient and sub-ingredient of list that is in
+// missing and has a grade, removing it from missing as it goes
+func clearGraded(store Store, list []data.Ingredient, missing map[string]bool) error {
+	for _, in := range list {
+		if in.Grade != -10 && missing[in.Name] {
+			if err := store.ClearMissingIngredient(in.Name); err != nil {
+				return err
+			}
+			delete(missing, in.Name)
+		}
+		if err := clearGraded(store, in.Children, missing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"IngredientGrader/grading"
+	"context"
+	"testing"
+)
+
+func TestRegradeCompound(t *testing.T) {
+	tests := []struct {
+		compound string
+		grade    string
+		queue    []string
+	}{
+		{"average", "good", nil},
+		{"worst", "good", nil},
+		{"first", "very good", nil},
+		{"none", grading.Missing, []string{"chocolate chips"}},
+	}
+	for _, tt := range tests {
+		config := grading.DefaultConfig
+		config.Compound = tt.compound
+		strategy, err := config.Build("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		store := NewMemoryStore()
+		for name, grade := range map[string]int{"sugar": 0, "flour": 2} {
+			if err := store.CreateIngredient(name, grade); err != nil {
+				t.Fatal(err)
+			}
+		}
+		food := data.Food{Barcode: "1", Name: "cookies", Ingredients: []data.Ingredient{
+			{Name: "flour"},
+			{Name: "chocolate chips", Children: []data.Ingredient{{Name: "cocoa"}, {Name: "sugar"}}},
+		}}
+		if _, err := AddFood(store, strategy, food); err != nil {
+			t.Fatal(err)
+		}
+		if queue := queued(t, store); len(queue) == 0 {
+			t.Fatalf("%s: nothing queued before cocoa is graded", tt.compound)
+		}
+
+		if err := GradeMissing(store, "cocoa", 4); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := RegradeFoodsContaining(context.Background(), store, strategy, "cocoa", nil); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := store.GetFood("1"); got.Grade != tt.grade {
+			t.Errorf("%s: food graded %q, want %q", tt.compound, got.Grade, tt.grade)
+		}
+		queue := queued(t, store)
+		if len(queue) != len(tt.queue) {
+			t.Errorf("%s: triage queue %v, want %v", tt.compound, queue, tt.queue)
+			continue
+		}
+		for i := range queue {
+			if queue[i] != tt.queue[i] {
+				t.Errorf("%s: triage queue %v, want %v", tt.compound, queue, tt.queue)
+			}
+		}
+	}
+}
+
+// queued returns the names in the triage queue
+func queued(t *testing.T, store Store) []string {
+	list, err := Triage(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range list {
+		names = append(names, m.Name)
+	}
+	return names
+}
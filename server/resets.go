@@ -0,0 +1,86 @@
+package server
+
+import (
+	"IngredientGrader/auth"
+	"IngredientGrader/mail"
+	"fmt"
+	"log"
+	"net/url"
+)
+
+// PasswordResets runs the forgotten password flow shared by the reset
+/* pages and the API: mailing a signed, single-use link to the account's
+   email address, then setting the new password once the link comes back.
+	BaseURL - The address of the site the link points at, without a
+	trailing slash
+*/
+type PasswordResets struct {
+	store    Store
+	tokens   *auth.Resets
+	mailer   mail.Mailer
+	sessions *auth.Manager
+	BaseURL  string
+}
+
+// NewPasswordResets returns a PasswordResets that reads accounts from
+/* store, issues tokens with tokens, sends links with mailer and signs
+   users out of sessions once their password is reset
+*/
+func NewPasswordResets(store Store, tokens *auth.Resets, mailer mail.Mailer, sessions *auth.Manager, baseURL string) *PasswordResets {
+	return &PasswordResets{store: store, tokens: tokens, mailer: mailer, sessions: sessions, BaseURL: baseURL}
+}
+
+// Send mails a reset link to the account called username. Nothing is
+/* sent, and no error returned, if there is no such account, it is
+   disabled or it has no email address, so callers cannot use the answer
+   to find out which usernames exist
+*/
+func (p *PasswordResets) Send(username string) error {
+	user, ok := p.store.GetUser(username)
+	if !ok || user.Disabled || user.Email == "" {
+		return nil
+	}
+	token, err := p.tokens.Issue(username)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/reset?token=%s", p.BaseURL, url.QueryEscape(token))
+	return p.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of %s.\n\n"+
+			"To choose a new password, open this link within the next %d minutes:\n%s\n\n"+
+			"If it was not you, you can ignore this email.\n", username, int(p.tokens.TTL.Minutes()), link),
+	})
+}
+
+// Check returns the username a reset token is for, or auth.ErrInvalidToken
+func (p *PasswordResets) Check(token string) (string, error) {
+	r, err := p.tokens.Check(token)
+	return r.Username, err
+}
+
+// Reset sets the password of the account token was issued for to pass,
+/* using up the token and signing the account out everywhere. Problems with
+   the new password are returned without using up the token, so the user
+   can try again
+*/
+func (p *PasswordResets) Reset(token, pass string) ([]string, error) {
+	username, err := p.Check(token)
+	if err != nil {
+		return nil, err
+	}
+	if problems := CheckPassword(username, pass); problems != nil {
+		return problems, nil
+	}
+	if username, err = p.tokens.Redeem(token); err != nil {
+		return nil, err
+	}
+	if err := SetPassword(Audited(p.store, username), username, pass); err != nil {
+		return nil, err
+	}
+	if err := p.sessions.EndAll(username); err != nil {
+		log.Println("server.Reset: ", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,731 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+)
+
+// SQLStore is a Store backed by a database/sql handle. The same statements
+// are used for MySQL and SQLite
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewMySQLStore returns a Store that runs its queries against a MySQL database
+func NewMySQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// NewSQLiteStore returns a Store that runs its queries against a SQLite database
+func NewSQLiteStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// GetFood retrieves Food data from the database and constructs a food
+/* object from it. The ingredients are returned in label order, each with
+   its current grade or -10 if it has not been graded. If the food does not
+   exist within the database, a zero Food and false is returned
+   barcode - The barcode associated with the food
+*/
+func (s *SQLStore) GetFood(barcode string) (data.Food, bool) {
+	var f data.Food
+	row := s.db.QueryRow("select barcode, title, ingredients, grade, numgrade from food where barcode=?;", barcode)
+	err := row.Scan(&f.Barcode, &f.Name, &f.Label, &f.Grade, &f.NumGrade)
+	if err == sql.ErrNoRows {
+		return data.Food{}, false
+	}
+	if err != nil {
+		log.Println("server.GetFood: ", err)
+		return data.Food{}, false
+	}
+
+	f.Ingredients, err = s.foodIngredients(barcode)
+	if err != nil {
+		log.Println("server.GetFood: ", err)
+	}
+	return f, true
+}
+
+// foodIngredients returns the ordered, graded ingredient tree of a food
+func (s *SQLStore) foodIngredients(barcode string) ([]data.Ingredient, error) {
+	rows, err := s.db.Query(`select fi.parent, fi.ingredient, coalesce(a.ingredient, ''), coalesce(i.grade, c.grade, -10),
+			fi.percent, fi.or_less, fi.alternatives, fi.position
+		from food_ingredients fi
+		left join ingredients i on i.title = fi.ingredient
+		left join ingredient_aliases a on a.alias = fi.ingredient
+		left join ingredients c on c.title = a.ingredient
+		where fi.barcode=? order by fi.position;`, barcode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []ingredientRow
+	for rows.Next() {
+		var r ingredientRow
+		in := &r.Ingredient
+		if err := rows.Scan(&r.parent, &in.Name, &in.Canonical, &in.Grade, &in.Percent, &in.OrLess, &in.Alternatives, &r.position); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return buildTree(list, -1), nil
+}
+
+// ingredientRow is a food_ingredients row, remembering where it sits in
+// the food's ingredient tree
+type ingredientRow struct {
+	data.Ingredient
+	position, parent int
+}
+
+// buildTree returns the ingredients in rows whose parent is at position
+// parent, in order, each with its own children
+func buildTree(rows []ingredientRow, parent int) []data.Ingredient {
+	var list []data.Ingredient
+	for _, r := range rows {
+		if r.parent == parent {
+			in := r.Ingredient
+			in.Children = buildTree(rows, r.position)
+			list = append(list, in)
+		}
+	}
+	return list
+}
+
+// CreateFood adds an entry to the database with the associated food data
+/* along with one food_ingredients row per ingredient, numbered in the
+   order they appear in food.Ingredients
+   food - The food being added. Name and ingredient names should be lowercase,
+	   Grade is the categorical grade and NumGrade the numerical grade
+*/
+func (s *SQLStore) CreateFood(food data.Food) error {
+	if _, exists := s.GetFood(food.Barcode); exists {
+		return ErrDuplicate
+	}
+
+	return s.withTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec("insert into food values(?, ?, ?, ?, ?);", food.Barcode, food.Name, food.Label, food.Grade, food.NumGrade)
+		if err != nil {
+			return err
+		}
+		return insertFoodIngredients(tx, food)
+	})
+}
+
+// insertFoodIngredients writes one food_ingredients row per ingredient
+/* and sub-ingredient, numbered in label order with each sub-ingredient
+   after the ingredient it belongs to, and pointing back to it
+*/
+func insertFoodIngredients(tx *sql.Tx, food data.Food) error {
+	pos := 0
+	var insert func(list []data.Ingredient, parent int) error
+	insert = func(list []data.Ingredient, parent int) error {
+		for _, in := range list {
+			self := pos
+			pos++
+			_, err := tx.Exec(`insert into food_ingredients (barcode, position, ingredient, parent, percent, or_less, alternatives)
+				values(?, ?, ?, ?, ?, ?, ?);`, food.Barcode, self, in.Name, parent, in.Percent, in.OrLess, in.Alternatives)
+			if err != nil {
+				return err
+			}
+			if err := insert(in.Children, self); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return insert(food.Ingredients, -1)
+}
+
+// UpdateFood replaces the stored fields and ingredient list of the food
+/* with a matching barcode. ErrNotFound is returned if there is no such food
+   food - The new state of the food. Its ingredient names should be lowercase
+*/
+func (s *SQLStore) UpdateFood(food data.Food) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("update food set title=?, ingredients=?, grade=?, numgrade=? where barcode=?;",
+			food.Name, food.Label, food.Grade, food.NumGrade, food.Barcode)
+		if err != nil {
+			return err
+		}
+		if err := mustAffect(res); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("delete from food_ingredients where barcode=?;", food.Barcode); err != nil {
+			return err
+		}
+		return insertFoodIngredients(tx, food)
+	})
+}
+
+// DeleteFood removes the food with a matching barcode, its ingredient
+// list and its missing ingredients. ErrNotFound is returned if there is no
+// such food
+func (s *SQLStore) DeleteFood(barcode string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("delete from food_ingredients where barcode=?;", barcode); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("delete from missing where barcode=?;", barcode); err != nil {
+			return err
+		}
+		res, err := tx.Exec("delete from food where barcode=?;", barcode)
+		if err != nil {
+			return err
+		}
+		return mustAffect(res)
+	})
+}
+
+// withTx runs fn inside a transaction, committing if it returns nil and
+// rolling back otherwise
+func (s *SQLStore) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// mustAffect turns an update or delete that matched no rows into ErrNotFound.
+// data.Init has MySQL count matched rows, so an update to the same values
+// still counts
+func mustAffect(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListFoods returns every food in the catalog, ordered by barcode
+func (s *SQLStore) ListFoods() ([]data.Food, error) {
+	return s.foodsWhere("select barcode from food order by barcode;")
+}
+
+// FoodsContaining returns every food that lists the ingredient name or
+// one of its aliases, as an ingredient or a sub-ingredient
+func (s *SQLStore) FoodsContaining(name string) ([]data.Food, error) {
+	return s.foodsWhere(`select distinct barcode from food_ingredients
+		where ingredient=? or ingredient in (select alias from ingredient_aliases where ingredient=?)
+		order by barcode;`, name, name)
+}
+
+// foodsWhere loads every food whose barcode is returned by query
+func (s *SQLStore) foodsWhere(query string, args ...interface{}) ([]data.Food, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var barcodes []string
+	for rows.Next() {
+		var bar string
+		if err := rows.Scan(&bar); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		barcodes = append(barcodes, bar)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	foods := make([]data.Food, 0, len(barcodes))
+	for _, bar := range barcodes {
+		if f, ok := s.GetFood(bar); ok {
+			foods = append(foods, f)
+		}
+	}
+	return foods, nil
+}
+
+// UpdateFoodGrade replaces the categorical and numerical grade of a food
+func (s *SQLStore) UpdateFoodGrade(barcode, grade string, numGrade float64) error {
+	_, err := s.db.Exec("update food set grade=?, numgrade=? where barcode=?;", grade, numGrade, barcode)
+	return err
+}
+
+// GetIngredient retrieves an ingredient with a matching name from the
+/* database, constructs an ingredient object. name does not need to be
+   checked for existence, as it is up to the user to check that
+   name - The name of the ingredient being retrieved
+*/
+func (s *SQLStore) GetIngredient(name string) data.Ingredient {
+	in := data.Ingredient{Name: name}
+	err := s.db.QueryRow(`select coalesce(a.ingredient, ''), coalesce(i.grade, -10)
+		from (select ? as name) n
+		left join ingredient_aliases a on a.alias = n.name
+		left join ingredients i on i.title = coalesce(a.ingredient, n.name);`, name).Scan(&in.Canonical, &in.Grade)
+	if err != nil {
+		log.Println("server.GetIngredient: ", err)
+		// Grade of -10 signals that no ingredient was found
+		return data.Ingredient{Name: name, Grade: -10}
+	}
+	return in
+}
+
+// CreateIngredient takes in the name and grade of a prospective ingredient,
+/* and adds it to the database. Currently, it is up to the user to check
+   that name and grade are valid inputs
+   name - The name of the ingredient being added, lowercase
+   grade - The grade of the ingredient, -5 to 5 inclusive integer
+*/
+func (s *SQLStore) CreateIngredient(name string, grade int) error {
+	if taken(s.GetIngredient(name)) {
+		return ErrDuplicate
+	}
+	_, err := s.db.Exec("insert into ingredients values(?, ?);", name, grade)
+	return err
+}
+
+// RecordMissingIngredient records the name of a missing ingredient to the
+/* database for administration to grade later
+   barcode - The food that lists the ingredient
+   name - THe name of the ingredient missing from the database
+*/
+func (s *SQLStore) RecordMissingIngredient(barcode, name string) error {
+	_, err := s.db.Exec("insert into missing (name, barcode) values(?, ?);", name, barcode)
+	return err
+}
+
+// UpdateIngredient replaces the ingredient called name with in. Renaming
+/* an ingredient also renames it in every food's ingredient list and in its
+   aliases, so those foods keep its grade
+   name - The current name of the ingredient
+   in - The new name and grade. ErrDuplicate is returned if the new name
+	   belongs to another ingredient, ErrNotFound if name does not exist
+*/
+func (s *SQLStore) UpdateIngredient(name string, in data.Ingredient) error {
+	if in.Name != name && taken(s.GetIngredient(in.Name)) {
+		return ErrDuplicate
+	}
+	return s.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("update ingredients set title=?, grade=? where title=?;", in.Name, in.Grade, name)
+		if err != nil {
+			return err
+		}
+		if err := mustAffect(res); err != nil {
+			return err
+		}
+		if in.Name == name {
+			return nil
+		}
+		if _, err := tx.Exec("update ingredient_aliases set ingredient=? where ingredient=?;", in.Name, name); err != nil {
+			return err
+		}
+		_, err = tx.Exec("update food_ingredients set ingredient=? where ingredient=?;", in.Name, name)
+		return err
+	})
+}
+
+// DeleteIngredient removes the ingredient called name. Foods that list it
+// are left alone. ErrNotFound is returned if there is no such ingredient
+func (s *SQLStore) DeleteIngredient(name string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("delete from ingredient_aliases where ingredient=?;", name); err != nil {
+			return err
+		}
+		res, err := tx.Exec("delete from ingredients where title=?;", name)
+		if err != nil {
+			return err
+		}
+		return mustAffect(res)
+	})
+}
+
+// ListIngredients returns every graded ingredient, ordered by name
+func (s *SQLStore) ListIngredients() ([]data.Ingredient, error) {
+	rows, err := s.db.Query("select title, grade from ingredients order by title;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []data.Ingredient
+	for rows.Next() {
+		var in data.Ingredient
+		if err := rows.Scan(&in.Name, &in.Grade); err != nil {
+			return nil, err
+		}
+		list = append(list, in)
+	}
+	return list, rows.Err()
+}
+
+// ListAliases returns every ingredient alias, ordered by alias
+func (s *SQLStore) ListAliases() ([]data.Alias, error) {
+	rows, err := s.db.Query("select alias, ingredient from ingredient_aliases order by alias;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []data.Alias
+	for rows.Next() {
+		var a data.Alias
+		if err := rows.Scan(&a.Name, &a.Ingredient); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// CreateAlias makes alias another name for ingredient. ErrDuplicate is
+// returned if alias is already an ingredient or an alias
+func (s *SQLStore) CreateAlias(alias, ingredient string) error {
+	var n int
+	err := s.db.QueryRow(`select (select count(*) from ingredients where title=?)
+		+ (select count(*) from ingredient_aliases where alias=?);`, alias, alias).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrDuplicate
+	}
+	_, err = s.db.Exec("insert into ingredient_aliases values(?, ?);", alias, ingredient)
+	return err
+}
+
+// DeleteAlias removes an alias. ErrNotFound is returned if there is no
+// such alias
+func (s *SQLStore) DeleteAlias(alias string) error {
+	res, err := s.db.Exec("delete from ingredient_aliases where alias=?;", alias)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+// ClearMissingIngredient deletes every row in missing recorded for name
+func (s *SQLStore) ClearMissingIngredient(name string) error {
+	_, err := s.db.Exec("delete from missing where name=?;", name)
+	return err
+}
+
+// ListMissingIngredients returns each name in missing once, ordered by name
+func (s *SQLStore) ListMissingIngredients() ([]string, error) {
+	rows, err := s.db.Query("select distinct name from missing order by name;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// CountMissingIngredients returns each name in missing once with how many
+// rows it has, most rows first
+func (s *SQLStore) CountMissingIngredients() ([]data.MissingIngredient, error) {
+	rows, err := s.db.Query("select name, count(*) from missing group by name order by count(*) desc, name;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []data.MissingIngredient
+	for rows.Next() {
+		var m data.MissingIngredient
+		if err := rows.Scan(&m.Name, &m.Count); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// GetHashedPassword retrieves a salted and hashed password with a matching
+/* username from the database. In the scenario that there is no matching
+   username, an empty string is returned
+   username - the username associated with the password
+   return - the salted and hashed password associated with the username
+*/
+func (s *SQLStore) GetHashedPassword(username string) string {
+	var pass string
+	err := s.db.QueryRow("select hashedPass from users where username=?;", username).Scan(&pass)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("server.GetHashedPassword: ", err)
+	}
+	return pass
+}
+
+// GetUser retrieves the account with a matching username from the database
+func (s *SQLStore) GetUser(username string) (data.User, bool) {
+	var u data.User
+	err := s.db.QueryRow("select username, role, disabled, email, totp_enabled from users where username=?;", username).Scan(&u.Username, &u.Role, &u.Disabled, &u.Email, &u.TwoFactor)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("server.GetUser: ", err)
+		}
+		return data.User{}, false
+	}
+	return u, true
+}
+
+// SetRole changes the role of the account called username. ErrNotFound is
+// returned if there is no such account
+func (s *SQLStore) SetRole(username, role string) error {
+	res, err := s.db.Exec("update users set role=? where username=?;", role, username)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+// CreateUser adds an account to the database
+/* user - The account being added. Disabled accounts can be created, but
+	   registration never does so
+   hash - The bcrypt hash of the account's password, from Obfuscate
+*/
+func (s *SQLStore) CreateUser(user data.User, hash string) error {
+	if _, exists := s.GetUser(user.Username); exists {
+		return ErrDuplicate
+	}
+	_, err := s.db.Exec("insert into users(username, hashedPass, role, disabled, email) values(?, ?, ?, ?, ?);", user.Username, hash, user.Role, user.Disabled, user.Email)
+	return err
+}
+
+// SetHashedPassword replaces the password hash of the account called
+// username. ErrNotFound is returned if there is no such account
+func (s *SQLStore) SetHashedPassword(username, hash string) error {
+	res, err := s.db.Exec("update users set hashedPass=? where username=?;", hash, username)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+// SetEmail changes the email address of the account called username.
+// ErrNotFound is returned if there is no such account
+func (s *SQLStore) SetEmail(username, email string) error {
+	res, err := s.db.Exec("update users set email=? where username=?;", email, username)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+// SetDisabled disables or re-enables the account called username.
+// ErrNotFound is returned if there is no such account
+func (s *SQLStore) SetDisabled(username string, disabled bool) error {
+	res, err := s.db.Exec("update users set disabled=? where username=?;", disabled, username)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+// ListUsers returns every account in the database, ordered by username
+func (s *SQLStore) ListUsers() ([]data.User, error) {
+	rows, err := s.db.Query("select username, role, disabled, email, totp_enabled from users order by username;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []data.User
+	for rows.Next() {
+		var u data.User
+		if err := rows.Scan(&u.Username, &u.Role, &u.Disabled, &u.Email, &u.TwoFactor); err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
+
+// GetTOTP retrieves the two-factor sign-in state of username from the
+// database. ErrNotFound is returned if there is no such account
+func (s *SQLStore) GetTOTP(username string) (data.TOTP, error) {
+	var t data.TOTP
+	err := s.db.QueryRow("select totp_secret, totp_enabled, totp_last from users where username=?;", username).
+		Scan(&t.Secret, &t.Enabled, &t.LastStep)
+	if err == sql.ErrNoRows {
+		return data.TOTP{}, ErrNotFound
+	}
+	return t, err
+}
+
+// SetTOTP replaces the two-factor sign-in state of username
+func (s *SQLStore) SetTOTP(username string, t data.TOTP) error {
+	res, err := s.db.Exec("update users set totp_secret=?, totp_enabled=?, totp_last=? where username=?;",
+		t.Secret, t.Enabled, t.LastStep, username)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+// UseTOTPStep records step as the last accepted step of username. The
+/* check and the write are one statement, so two requests racing with the
+   same code cannot both succeed
+*/
+func (s *SQLStore) UseTOTPStep(username string, step int64) (bool, error) {
+	res, err := s.db.Exec("update users set totp_last=? where username=? and totp_last < ?;", step, username, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// SetRecoveryCodes replaces the hashed recovery codes of username
+func (s *SQLStore) SetRecoveryCodes(username string, hashes []string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("delete from recovery_codes where username=?;", username); err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if _, err := tx.Exec("insert into recovery_codes values(?, ?);", username, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UseRecoveryCode deletes a hashed recovery code of username, reporting
+// whether it was there
+func (s *SQLStore) UseRecoveryCode(username, hash string) (bool, error) {
+	res, err := s.db.Exec("delete from recovery_codes where username=? and code=?;", username, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CountRecoveryCodes returns how many recovery codes username has left
+func (s *SQLStore) CountRecoveryCodes(username string) (int, error) {
+	var n int
+	err := s.db.QueryRow("select count(*) from recovery_codes where username=?;", username).Scan(&n)
+	return n, err
+}
+
+// The settings rows behind the fields of data.Settings
+const (
+	settingRequireAdminTwoFactor = "require_admin_two_factor"
+	settingAutoMatch             = "auto_match"
+)
+
+// GetSettings reads the site-wide settings from the settings table.
+// Settings with no row keep their zero value
+func (s *SQLStore) GetSettings() (data.Settings, error) {
+	var settings data.Settings
+	rows, err := s.db.Query("select name, value from settings;")
+	if err != nil {
+		return settings, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return settings, err
+		}
+		switch name {
+		case settingRequireAdminTwoFactor:
+			settings.RequireAdminTwoFactor = value == "true"
+		case settingAutoMatch:
+			settings.AutoMatch, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	return settings, rows.Err()
+}
+
+// SetSettings writes every site-wide setting to the settings table
+func (s *SQLStore) SetSettings(settings data.Settings) error {
+	values := map[string]string{
+		settingRequireAdminTwoFactor: strconv.FormatBool(settings.RequireAdminTwoFactor),
+		settingAutoMatch:             strconv.FormatFloat(settings.AutoMatch, 'f', -1, 64),
+	}
+	return s.withTx(func(tx *sql.Tx) error {
+		for name, value := range values {
+			if _, err := tx.Exec("delete from settings where name=?;", name); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("insert into settings values(?, ?);", name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RecordAudit appends an entry to the audit_log table. Before and After
+// are stored as text, with empty strings for missing ones
+func (s *SQLStore) RecordAudit(e data.AuditEntry) error {
+	_, err := s.db.Exec("insert into audit_log(at, actor, action, entity, entity_id, before_state, after_state) values(?, ?, ?, ?, ?, ?, ?);",
+		e.At.Unix(), e.Actor, e.Action, e.Entity, e.EntityID, string(e.Before), string(e.After))
+	return err
+}
+
+// ListAudit returns the entries of the audit_log table that match filter,
+// newest first
+func (s *SQLStore) ListAudit(filter data.AuditFilter) ([]data.AuditEntry, error) {
+	query := "select id, at, actor, action, entity, entity_id, before_state, after_state from audit_log where 1=1"
+	var args []interface{}
+	for _, cond := range []struct {
+		column string
+		value  string
+	}{{"entity", filter.Entity}, {"entity_id", filter.EntityID}, {"actor", filter.Actor}} {
+		if cond.value != "" {
+			query += " and " + cond.column + "=?"
+			args = append(args, cond.value)
+		}
+	}
+	if filter.Before != 0 {
+		query += " and id<?"
+		args = append(args, filter.Before)
+	}
+	query += " order by id desc limit ?;"
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []data.AuditEntry
+	for rows.Next() {
+		var (
+			e             data.AuditEntry
+			at            int64
+			before, after string
+		)
+		if err := rows.Scan(&e.ID, &at, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &before, &after); err != nil {
+			return nil, err
+		}
+		e.At = time.Unix(at, 0)
+		if before != "" {
+			e.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			e.After = json.RawMessage(after)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
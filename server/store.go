@@ -0,0 +1,130 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"errors"
+)
+
+// ErrDuplicate is returned by a Store when the food or ingredient being
+// created already exists
+var ErrDuplicate = errors.New("server: entry already exists")
+
+// ErrNotFound is returned by a Store when the food or ingredient being
+// changed does not exist
+var ErrNotFound = errors.New("server: no such entry")
+
+// Store is the set of reads and writes the site needs from its backing
+/* database. Handlers receive a Store through their constructor rather than
+   reaching for a package-level handle, so the grader can run against MySQL,
+   SQLite, or an in-memory catalog without any other changes.
+*/
+type Store interface {
+	// GetFood returns the food with a matching barcode, its ingredients in
+	// label order with their current grades. If the food does not exist, a
+	// zero Food and false are returned
+	GetFood(barcode string) (data.Food, bool)
+	// CreateFood adds a food and its ordered ingredient tree to the catalog.
+	// The grades of food.Ingredients are not stored
+	CreateFood(food data.Food) error
+	// UpdateFood replaces the name, label, ingredient list and grade of the
+	// food with food.Barcode
+	UpdateFood(food data.Food) error
+	// DeleteFood removes a food and its ingredient list from the catalog,
+	// along with the missing ingredients recorded for it
+	DeleteFood(barcode string) error
+	// ListFoods returns every food in the catalog, ordered by barcode
+	ListFoods() ([]data.Food, error)
+	// FoodsContaining returns every food whose ingredients or
+	// sub-ingredients include name or one of its aliases
+	FoodsContaining(name string) ([]data.Food, error)
+	// UpdateFoodGrade replaces the stored grade of a food
+	UpdateFoodGrade(barcode, grade string, numGrade float64) error
+
+	// GetIngredient returns the ingredient with a matching name. If name is
+	// an alias, the ingredient it stands for is returned with Name left as
+	// given and Canonical set. If the ingredient does not exist, its Grade
+	// is -10
+	GetIngredient(name string) data.Ingredient
+	// CreateIngredient adds an ingredient to the catalog
+	CreateIngredient(name string, grade int) error
+	// UpdateIngredient replaces the ingredient called name with in. If the
+	// name changes, foods that list the ingredient and its aliases follow
+	// the new name
+	UpdateIngredient(name string, in data.Ingredient) error
+	// DeleteIngredient removes an ingredient from the catalog, along with
+	// the aliases that stand for it. Foods that list it or its aliases keep
+	// them in their ingredient list, ungraded
+	DeleteIngredient(name string) error
+	// ListIngredients returns every graded ingredient, ordered by name
+	ListIngredients() ([]data.Ingredient, error)
+
+	// ListAliases returns every ingredient alias, ordered by alias
+	ListAliases() ([]data.Alias, error)
+	// CreateAlias makes alias another name for the ingredient called
+	// ingredient. ErrDuplicate is returned if alias is already an ingredient
+	// or an alias
+	CreateAlias(alias, ingredient string) error
+	// DeleteAlias removes an alias. Foods that list it are left ungraded.
+	// ErrNotFound is returned if there is no such alias
+	DeleteAlias(alias string) error
+
+	// RecordMissingIngredient records the name of an ingredient the food
+	// with barcode lists that has no grade yet, so it can be graded later
+	RecordMissingIngredient(barcode, name string) error
+	// ClearMissingIngredient removes every record of name from the missing
+	// ingredients
+	ClearMissingIngredient(name string) error
+	// ListMissingIngredients returns the distinct names recorded as
+	// missing, ordered by name
+	ListMissingIngredients() ([]string, error)
+	// CountMissingIngredients returns each name recorded as missing once,
+	// with how many times it was recorded, most recorded first. Foods is
+	// left empty
+	CountMissingIngredients() ([]data.MissingIngredient, error)
+
+	// GetHashedPassword returns the bcrypt hash stored for username, or an
+	// empty string if there is no such user
+	GetHashedPassword(username string) string
+	// GetUser returns the account called username. The second value is
+	// false if there is no such user
+	GetUser(username string) (data.User, bool)
+	// SetRole changes the role of the account called username
+	SetRole(username, role string) error
+	// CreateUser adds an account with the bcrypt hash of its password.
+	// ErrDuplicate is returned if the username is taken
+	CreateUser(user data.User, hash string) error
+	// SetHashedPassword replaces the bcrypt hash stored for username
+	SetHashedPassword(username, hash string) error
+	// SetEmail changes the email address of the account called username
+	SetEmail(username, email string) error
+	// SetDisabled disables or re-enables the account called username
+	SetDisabled(username string, disabled bool) error
+	// ListUsers returns every account, ordered by username
+	ListUsers() ([]data.User, error)
+
+	// GetTOTP returns the two-factor sign-in state of username
+	GetTOTP(username string) (data.TOTP, error)
+	// SetTOTP replaces the two-factor sign-in state of username
+	SetTOTP(username string, t data.TOTP) error
+	// UseTOTPStep records that a code from step was accepted for username.
+	// It returns false if a code from step or a later one already was
+	UseTOTPStep(username string, step int64) (bool, error)
+	// SetRecoveryCodes replaces the hashed recovery codes of username
+	SetRecoveryCodes(username string, hashes []string) error
+	// UseRecoveryCode deletes a hashed recovery code of username. It
+	// returns false if the account had no such code
+	UseRecoveryCode(username, hash string) (bool, error)
+	// CountRecoveryCodes returns how many recovery codes username has left
+	CountRecoveryCodes(username string) (int, error)
+
+	// GetSettings returns the site-wide settings
+	GetSettings() (data.Settings, error)
+	// SetSettings replaces the site-wide settings
+	SetSettings(settings data.Settings) error
+
+	// RecordAudit appends an entry to the audit log. Its ID is assigned by
+	// the Store. There is no way to change or remove an entry
+	RecordAudit(e data.AuditEntry) error
+	// ListAudit returns the entries that match filter, newest first
+	ListAudit(filter data.AuditFilter) ([]data.AuditEntry, error)
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"IngredientGrader/grading"
+)
+
+/* Triage works through the ingredients MakeFood found no grade for. Each
+   one is either graded, made an alias of an ingredient that already has a
+   grade, or dismissed. Callers regrade the foods it blocked afterwards, in
+   the background.
+*/
+
+// Triage returns the missing ingredients, each once, most recorded first,
+// with the foods each one blocks and the graded ingredients it may mean
+func Triage(store Store) ([]data.MissingIngredient, error) {
+	list, err := store.CountMissingIngredients()
+	if err != nil || len(list) == 0 {
+		return list, err
+	}
+	m, err := NewMatcher(store)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Foods, err = blockedBy(store, list[i].Name); err != nil {
+			return nil, err
+		}
+		list[i].Suggestions = suggestions(m, list[i].Name)
+	}
+	return list, nil
+}
+
+// blockedBy returns the foods that are graded missing and list name
+/* without a grade, either as an ingredient or a sub-ingredient. Foods that
+   list it but already grade through an alias are left out
+*/
+func blockedBy(store Store, name string) ([]data.Food, error) {
+	foods, err := store.FoodsContaining(name)
+	if err != nil {
+		return nil, err
+	}
+	var blocked []data.Food
+	for _, f := range foods {
+		if f.Grade == grading.Missing && ungradedIn(f.Ingredients, name) {
+			blocked = append(blocked, f)
+		}
+	}
+	return blocked, nil
+}
+
+// ungradedIn reports whether list or any of its sub-ingredients lists name
+// without a grade
+func ungradedIn(list []data.Ingredient, name string) bool {
+	for _, in := range list {
+		if in.Name == name && in.Grade == -10 || ungradedIn(in.Children, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GradeMissing creates the missing ingredient name with grade and clears
+/* it from the triage queue. grade should already have passed
+   CheckIngredient
+   return - ErrDuplicate if name was graded in the meantime
+*/
+func GradeMissing(store Store, name string, grade int) error {
+	if err := store.CreateIngredient(name, grade); err != nil {
+		return err
+	}
+	return store.ClearMissingIngredient(name)
+}
+
+// AliasMissing makes the missing ingredient name an alias of canonical, so
+/* foods that list it take canonical's grade, and clears name from the
+   triage queue. The arguments should already have passed CheckAlias
+*/
+func AliasMissing(store Store, name, canonical string) error {
+	if err := store.CreateAlias(name, canonical); err != nil {
+		return err
+	}
+	return store.ClearMissingIngredient(name)
+}
+
+// DismissMissing clears name from the triage queue without grading it,
+/* recording who did so in the audit log. Foods that list it stay ungraded,
+   and it is queued again the next time a food is saved with it
+*/
+func DismissMissing(store Store, actor, name string) error {
+	if err := store.ClearMissingIngredient(name); err != nil {
+		return err
+	}
+	Audit(store, actor, ActionDismiss, EntityIngredient, name, nil, nil)
+	return nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"IngredientGrader/data"
+	"IngredientGrader/totp"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+/* Two-factor sign-in with authenticator app codes (see package totp), and
+   single-use recovery codes for when the app is lost. Shared by the
+   account and login pages and the API.
+*/
+
+// TwoFactorIssuer is the name authenticator apps show next to the code
+const TwoFactorIssuer = "Health Guru"
+
+// recoveryCodeCount is how many recovery codes an account is given
+const recoveryCodeCount = 10
+
+// ErrTwoFactorEnabled is returned when enrollment is started for an
+// account that already signs in with a code
+var ErrTwoFactorEnabled = errors.New("server: two-factor sign-in is already on")
+
+// StartTwoFactor begins enrollment for username, returning the secret to
+/* load into their authenticator app. Until EnableTwoFactor is called with
+   a code from the app, signing in does not ask for one. Calling it again
+   before then returns the same secret, so reloading the page does not
+   invalidate a QR code that has already been scanned
+*/
+func StartTwoFactor(store Store, username string) (data.TOTP, error) {
+	t, err := store.GetTOTP(username)
+	if err != nil {
+		return t, err
+	}
+	if t.Enabled {
+		return t, ErrTwoFactorEnabled
+	}
+	if t.Secret != "" {
+		return t, nil
+	}
+	if t.Secret, err = totp.NewSecret(); err != nil {
+		return t, err
+	}
+	return t, store.SetTOTP(username, t)
+}
+
+// EnableTwoFactor finishes enrollment once the user enters a code from
+/* their app, and returns their new recovery codes. Problems with the code
+   are returned as messages for the page
+*/
+func EnableTwoFactor(store Store, username, code string) ([]string, []string, error) {
+	t, err := store.GetTOTP(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.Enabled {
+		return nil, nil, ErrTwoFactorEnabled
+	}
+	step, ok := totp.Verify(t.Secret, code, time.Now())
+	if t.Secret == "" || !ok {
+		return nil, []string{"The code is incorrect. Check that your device's clock is right"}, nil
+	}
+	t.Enabled, t.LastStep = true, step
+	if err := store.SetTOTP(username, t); err != nil {
+		return nil, nil, err
+	}
+	codes, err := NewRecoveryCodes(store, username)
+	return codes, nil, err
+}
+
+// DisableTwoFactor turns two-factor sign-in off for username and throws
+// away their secret and recovery codes
+func DisableTwoFactor(store Store, username string) error {
+	if err := store.SetTOTP(username, data.TOTP{}); err != nil {
+		return err
+	}
+	return store.SetRecoveryCodes(username, nil)
+}
+
+// CheckSecondFactor returns true if code is a code from username's app that
+/* has not been used before, or one of their unused recovery codes, which
+   is then used up
+*/
+func CheckSecondFactor(store Store, username, code string) (bool, error) {
+	t, err := store.GetTOTP(username)
+	if err != nil || !t.Enabled {
+		return false, err
+	}
+	if step, ok := totp.Verify(t.Secret, code, time.Now()); ok {
+		return store.UseTOTPStep(username, step)
+	}
+	return store.UseRecoveryCode(username, hashRecoveryCode(code))
+}
+
+// NewRecoveryCodes replaces username's recovery codes with new ones and
+// returns them. Only their hashes are stored, so they can be shown only once
+func NewRecoveryCodes(store Store, username string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, store.SetRecoveryCodes(username, hashes)
+}
+
+// hashRecoveryCode returns the hash a recovery code is stored under. Case,
+// spaces and dashes are ignored, since users copy them by hand
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// TwoFactorStatus returns the two-factor state of username for the account
+/* pages. If enrollment has started but not finished, the secret and its
+   provisioning URI are included
+*/
+func TwoFactorStatus(store Store, username string, required bool) (data.TwoFactor, error) {
+	status := data.TwoFactor{Required: required}
+	t, err := store.GetTOTP(username)
+	if err != nil {
+		return status, err
+	}
+	status.Enabled = t.Enabled
+	if t.Enabled {
+		status.CodesLeft, err = store.CountRecoveryCodes(username)
+		return status, err
+	}
+	if t.Secret != "" {
+		status.Secret = t.Secret
+		status.URI = totp.URI(TwoFactorIssuer, username, t.Secret)
+	}
+	return status, nil
+}
+
+// RequiresTwoFactor reports whether accounts with role must use two-factor
+// sign-in under the current settings
+func RequiresTwoFactor(store Store, role string) bool {
+	if role != "admin" {
+		return false
+	}
+	settings, err := store.GetSettings()
+	if err != nil {
+		log.Println("server.RequiresTwoFactor: ", err)
+		return false
+	}
+	return settings.RequireAdminTwoFactor
+}
@@ -0,0 +1,238 @@
+package statement
+
+/* Package statement parses the ingredient statements printed on food
+   labels into a tree. A statement lists ingredients separated by commas or
+   semicolons, and any of them may be a compound whose own ingredients
+   follow it in brackets:
+
+	enriched flour (wheat flour, niacin, iron), sugar 10%, vitamin c
+	[ascorbic acid], soybean and/or canola oil, contains 2% or less of:
+	salt, yeast
+
+   Percentages after a name or alone in brackets are kept with the
+   ingredient. Everything after a "contains 2% or less of:" marker is
+   flagged as making up at most that share, and alternatives joined by
+   "or" or "and/or" become the children of one ingredient. Allergen
+   statements such as "contains: milk" end the list they start. Parsing
+   never fails; unbalanced brackets are closed at the end of the statement.
+*/
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ingredient is one entry of an ingredient statement
+/*	Name - The ingredient's name, lowercase, without its brackets or
+	percentage
+	Percent - The share of the food it makes up, from 0 to 100. 0 if the
+	label does not say. For OrLess ingredients it is the most it can be
+	OrLess - Whether it was listed after a "contains 2% or less of" marker
+	Alternatives - Whether Children are alternatives, as in "soybean and/or
+	canola oil", rather than the parts of a compound
+	Children - The ingredients listed in brackets after it, or its
+	alternatives
+*/
+type Ingredient struct {
+	Name         string
+	Percent      float64
+	OrLess       bool
+	Alternatives bool
+	Children     []Ingredient
+}
+
+var (
+	// prefix matches an "Ingredients:" heading before the list
+	prefix = regexp.MustCompile(`^\s*ingredients?\s*:\s*`)
+	// orLess matches a "contains 2% or less of:" marker at the start of an
+	// entry, capturing the percentage
+	orLess = regexp.MustCompile(`^(?:contains\s+)?(?:less\s+than\s+(\d+(?:\.\d+)?)\s*%|(\d+(?:\.\d+)?)\s*%\s*or\s+less)(?:\s+of)?(?:\s+each)?(?:\s+of)?(?:\s+the\s+following)?\s*:?\s*`)
+	// allergens matches an allergen statement at the start of an entry
+	allergens = regexp.MustCompile(`^(?:contains|may\s+contain)\b`)
+	// percentOnly matches brackets holding nothing but a percentage
+	percentOnly = regexp.MustCompile(`^(?:min\.?|max\.?|minimum|maximum|at\s+least)?\s*(\d+(?:\.\d+)?)\s*%$`)
+	// trailingPercent matches a percentage after a name
+	trailingPercent = regexp.MustCompile(`\s*(\d+(?:\.\d+)?)\s*%$`)
+	// alternatives matches the words joining alternatives
+	alternatives = regexp.MustCompile(`\s+(?:and/or|or)\s+`)
+	// dangling matches joining words left at either end of a name, as in
+	// "wheat or rye or"
+	dangling = regexp.MustCompile(`^(?:(?:and/or|or)(?:\s+|$))+|(?:(?:^|\s+)(?:and/or|or))+$`)
+)
+
+// sharedHeads are the words alternatives commonly share, as "oil" is
+// shared in "soybean and/or canola oil"
+var sharedHeads = map[string]bool{
+	"oil": true, "oils": true, "flour": true, "starch": true, "fat": true,
+	"fats": true, "shortening": true, "lecithin": true, "protein": true,
+	"meal": true, "fiber": true, "fibre": true,
+}
+
+// Parse reads an ingredient statement into its ingredients in label order
+func Parse(text string) []Ingredient {
+	text = prefix.ReplaceAllString(strings.ToLower(text), "")
+	return parseList(strings.TrimRight(strings.TrimSpace(text), "."))
+}
+
+// parseList parses a list of entries, such as a whole statement or the
+// inside of a compound's brackets
+func parseList(text string) []Ingredient {
+	var list []Ingredient
+	limit, limited := 0.0, false
+	for _, entry := range splitTop(text) {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), "and ")
+		if m := orLess.FindStringSubmatch(entry); m != nil {
+			limited = true
+			limit, _ = strconv.ParseFloat(m[1]+m[2], 64)
+			entry = entry[len(m[0]):]
+		} else if allergens.MatchString(entry) {
+			break
+		}
+		in, ok := parseEntry(entry)
+		if !ok {
+			continue
+		}
+		if limited {
+			in.OrLess = true
+			if in.Percent == 0 {
+				in.Percent = limit
+			}
+		}
+		list = append(list, in)
+	}
+	return list
+}
+
+// parseEntry parses one entry of a list. The second value is false if the
+// entry names nothing
+func parseEntry(entry string) (Ingredient, bool) {
+	var in Ingredient
+	name, groups := splitGroups(entry)
+	for _, g := range groups {
+		g = strings.TrimSpace(g)
+		if m := percentOnly.FindStringSubmatch(g); m != nil {
+			in.Percent, _ = strconv.ParseFloat(m[1], 64)
+			continue
+		}
+		in.Children = append(in.Children, parseList(g)...)
+	}
+
+	name = clean(name)
+	if m := trailingPercent.FindStringSubmatch(name); m != nil {
+		in.Percent, _ = strconv.ParseFloat(m[1], 64)
+		name = clean(name[:len(name)-len(m[0])])
+	}
+	name = clean(dangling.ReplaceAllString(name, ""))
+	if name == "" {
+		return in, false
+	}
+	in.Name = name
+	if len(in.Children) == 0 {
+		if parts := splitAlternatives(name); len(parts) > 1 {
+			in.Alternatives = true
+			for _, part := range parts {
+				in.Children = append(in.Children, Ingredient{Name: part})
+			}
+		}
+	}
+	return in, true
+}
+
+// splitAlternatives splits a name like "soybean and/or canola oil" into
+/* its alternatives. When the last one ends in a word such as oil or flour
+   that the others lack, they share it, so that name gives "soybean oil"
+   and "canola oil"
+*/
+func splitAlternatives(name string) []string {
+	parts := alternatives.Split(name, -1)
+	if len(parts) < 2 {
+		return nil
+	}
+	last := strings.Fields(parts[len(parts)-1])
+	head := last[len(last)-1]
+	share := len(last) > 1 && sharedHeads[head]
+	var list []string
+	for i, part := range parts {
+		part = clean(part)
+		if part == "" {
+			continue
+		}
+		words := strings.Fields(part)
+		if share && i < len(parts)-1 && !sharedHeads[words[len(words)-1]] {
+			part += " " + head
+		}
+		list = append(list, part)
+	}
+	return list
+}
+
+// clean collapses the spaces in a name and trims the marks labels put
+// around names, such as the asterisks that point to footnotes
+func clean(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	return strings.Trim(name, " *†‡:.-")
+}
+
+// opens and closes are the brackets compounds list their ingredients in
+const (
+	opens  = "([{"
+	closes = ")]}"
+)
+
+// splitTop splits text at the commas and semicolons that are not inside
+/* brackets, and at periods that end the list before an allergen statement.
+   Other periods are left alone, since they mostly end abbreviations such as
+   "st. john's wort"
+*/
+func splitTop(text string) []string {
+	var entries []string
+	depth, start := 0, 0
+	runes := []rune(text)
+	for i, r := range runes {
+		switch {
+		case strings.ContainsRune(opens, r):
+			depth++
+		case strings.ContainsRune(closes, r):
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && (r == ',' || r == ';' || r == '.' && allergens.MatchString(strings.TrimSpace(string(runes[i+1:])))):
+			entries = append(entries, string(runes[start:i]))
+			start = i + 1
+		}
+	}
+	return append(entries, string(runes[start:]))
+}
+
+// splitGroups separates an entry into the text outside its brackets and
+// the text inside each outermost pair. Unclosed brackets run to the end
+func splitGroups(entry string) (string, []string) {
+	var outside strings.Builder
+	var groups []string
+	depth, start := 0, 0
+	runes := []rune(entry)
+	for i, r := range runes {
+		switch {
+		case strings.ContainsRune(opens, r):
+			if depth == 0 {
+				start = i + 1
+				outside.WriteRune(' ')
+			}
+			depth++
+		case strings.ContainsRune(closes, r):
+			if depth == 0 {
+				continue
+			}
+			if depth--; depth == 0 {
+				groups = append(groups, string(runes[start:i]))
+			}
+		case depth == 0:
+			outside.WriteRune(r)
+		}
+	}
+	if depth > 0 {
+		groups = append(groups, string(runes[start:]))
+	}
+	return outside.String(), groups
+}
@@ -0,0 +1,125 @@
+package statement
+
+import (
+	"reflect"
+	"testing"
+)
+
+// leaf returns an ingredient with no children
+func leaf(name string) Ingredient {
+	return Ingredient{Name: name}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Ingredient
+	}{
+		{
+			"enriched flour (wheat flour, niacin, iron)",
+			[]Ingredient{{Name: "enriched flour", Children: []Ingredient{leaf("wheat flour"), leaf("niacin"), leaf("iron")}}},
+		},
+		{
+			"contains 2% or less of: salt, yeast",
+			[]Ingredient{{Name: "salt", Percent: 2, OrLess: true}, {Name: "yeast", Percent: 2, OrLess: true}},
+		},
+		{
+			"soybean and/or canola oil",
+			[]Ingredient{{Name: "soybean and/or canola oil", Alternatives: true, Children: []Ingredient{leaf("soybean oil"), leaf("canola oil")}}},
+		},
+		{
+			"vitamin c [ascorbic acid]",
+			[]Ingredient{{Name: "vitamin c", Children: []Ingredient{leaf("ascorbic acid")}}},
+		},
+		{
+			"Ingredients: Water, Sugar 10%, Cocoa (22%).",
+			[]Ingredient{leaf("water"), {Name: "sugar", Percent: 10}, {Name: "cocoa", Percent: 22}},
+		},
+		{
+			"chocolate chips (sugar, chocolate {cocoa mass, cocoa butter}), salt",
+			[]Ingredient{
+				{Name: "chocolate chips", Children: []Ingredient{
+					leaf("sugar"),
+					{Name: "chocolate", Children: []Ingredient{leaf("cocoa mass"), leaf("cocoa butter")}},
+				}},
+				leaf("salt"),
+			},
+		},
+		{
+			"flour; sugar; and salt",
+			[]Ingredient{leaf("flour"), leaf("sugar"), leaf("salt")},
+		},
+		{
+			"sugar, contains less than 1% of salt, spices (paprika 0.5%)",
+			[]Ingredient{
+				leaf("sugar"),
+				{Name: "salt", Percent: 1, OrLess: true},
+				{Name: "spices", Percent: 1, OrLess: true, Children: []Ingredient{{Name: "paprika", Percent: 0.5}}},
+			},
+		},
+		{
+			"wheat flour, milk. contains: wheat, milk",
+			[]Ingredient{leaf("wheat flour"), leaf("milk")},
+		},
+		{
+			"st. john's wort, salt",
+			[]Ingredient{leaf("st. john's wort"), leaf("salt")},
+		},
+		{
+			"wheat or rye or",
+			[]Ingredient{{Name: "wheat or rye", Alternatives: true, Children: []Ingredient{leaf("wheat"), leaf("rye")}}},
+		},
+		{
+			"or",
+			nil,
+		},
+		{
+			"corn or potato starch",
+			[]Ingredient{{Name: "corn or potato starch", Alternatives: true, Children: []Ingredient{leaf("corn starch"), leaf("potato starch")}}},
+		},
+		{
+			"apples or pears",
+			[]Ingredient{{Name: "apples or pears", Alternatives: true, Children: []Ingredient{leaf("apples"), leaf("pears")}}},
+		},
+		{
+			"sugar*, salt**",
+			[]Ingredient{leaf("sugar"), leaf("salt")},
+		},
+		{
+			"flour (wheat, malted barley",
+			[]Ingredient{{Name: "flour", Children: []Ingredient{leaf("wheat"), leaf("malted barley")}}},
+		},
+		{
+			"salt), sugar",
+			[]Ingredient{leaf("salt"), leaf("sugar")},
+		},
+		{
+			" , ,, ",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) =\n\t%+v\nwant\n\t%+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"enriched flour (wheat flour, niacin, iron)",
+		"contains 2% or less of: salt, yeast",
+		"soybean and/or canola oil",
+		"vitamin c [ascorbic acid]",
+		"a or b or, (((, ]]) 5% or less:",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		for _, in := range Parse(text) {
+			if in.Name == "" {
+				t.Errorf("Parse(%q) returned an ingredient without a name", text)
+			}
+		}
+	})
+}
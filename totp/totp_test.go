@@ -0,0 +1,109 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of RFC 6238 Appendix B, "12345678901234567890",
+// base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The Appendix B codes are eight digits; these are their last six, which is
+// what truncating to Digits gives
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	got, err := Code(strings.ToLower(rfcSecret), 1)
+	if err != nil || got != "287082" {
+		t.Errorf("Code with a lowercase secret = %q, %v; want 287082", got, err)
+	}
+}
+
+func TestCodeBadSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted a secret that is not base32")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	now := Step(at)
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+		step int64
+	}{
+		{"current step", "050471", true, now},
+		{"spaces are ignored", "050 471", true, now},
+		{"previous step", "081804", true, now - 1},
+		{"wrong code", "123456", false, 0},
+		{"too short", "05047", false, 0},
+		{"too long", "0504710", false, 0},
+	}
+	for _, tt := range tests {
+		step, ok := Verify(rfcSecret, tt.code, at)
+		if ok != tt.ok || step != tt.step {
+			t.Errorf("%s: Verify(%q) = %d, %v; want %d, %v", tt.name, tt.code, step, ok, tt.step, tt.ok)
+		}
+	}
+}
+
+func TestVerifySkew(t *testing.T) {
+	code, _ := Code(rfcSecret, 100)
+	for offset, want := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		at := time.Unix((100+offset)*Period, 0)
+		if _, ok := Verify(rfcSecret, code, at); ok != want {
+			t.Errorf("code for step 100 at step %d: Verify = %v, want %v", 100+offset, ok, want)
+		}
+	}
+}
+
+func TestNewSecretRoundTrip(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("NewSecret is %d characters, want 32", len(secret))
+	}
+	code, err := Code(secret, Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Verify(secret, code, time.Now()); !ok {
+		t.Error("Verify rejected the current code for a new secret")
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Ingredient Grader", "ann", "ABC")
+	for _, part := range []string{"otpauth://totp/Ingredient%20Grader:ann?", "secret=ABC", "digits=6", "period=30", "algorithm=SHA1"} {
+		if !strings.Contains(got, part) {
+			t.Errorf("URI = %s, missing %s", got, part)
+		}
+	}
+}